@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"os"
+	"t3sesame/internal/documents"
 	"t3sesame/internal/handlers"
+	"t3sesame/internal/indexer"
+	"t3sesame/internal/llm"
+	"t3sesame/internal/markdown"
 	"t3sesame/internal/models"
+	"t3sesame/internal/storage"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
@@ -40,6 +46,15 @@ func main() {
 		log.Fatal("Failed to run migrations:", err)
 	}
 
+	// Seed the models catalog
+	modelService := models.NewModelService(db)
+	catalogPath := getEnv("MODEL_CATALOG", "config/models.json")
+	if n, err := modelService.SeedFromFile(catalogPath); err != nil {
+		log.Printf("Failed to seed models from %s: %v", catalogPath, err)
+	} else {
+		log.Printf("Seeded %d models from %s", n, catalogPath)
+	}
+
 	// Initialize Echo
 	e := echo.New()
 
@@ -54,14 +69,44 @@ func main() {
 
 	// Static files
 	e.Static("/static", "static")
+	// Generated from the code highlighting style, so it always matches
+	e.GET("/static/css/highlight.css", func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderContentType, "text/css; charset=utf-8")
+		return markdown.WriteCSS(c.Response())
+	})
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(db)
 	chatService := models.NewChatService(db)
-	chatHandler := handlers.NewChatHandler(chatService)
+	providers := newProviderRegistry()
+	embedder := newEmbedder()
+	documentService := models.NewDocumentService(db)
+	retriever := documents.NewRetriever(documentService, embedder)
+	blobs, err := storage.NewLocalBlobStore(getEnv("BLOB_DIR", "data/blobs"))
+	if err != nil {
+		log.Fatal("Failed to open blob store:", err)
+	}
+	chatHandler := handlers.NewChatHandler(chatService, modelService, providers, retriever, blobs,
+		getEnv("DEFAULT_MODEL", "fake/echo"), os.Getenv("TITLE_MODEL"))
+	documentHandler := handlers.NewDocumentHandler(chatService, documentService, retriever)
+	importHandler := handlers.NewImportHandler(chatService, modelService)
+	shareHandler := handlers.NewShareHandler(chatService, models.NewShareService(db), blobs)
 	oauthHandler := handlers.NewOAuthHandler(models.NewUserService(db))
 
+	// Index messages for semantic search in the background
+	embeddingService := models.NewEmbeddingService(db)
+	go indexer.New(embeddingService, embedder).Run(context.Background())
+	searchHandler := handlers.NewSearchHandler(chatService, embeddingService, embedder)
+
+	// JSON API for scripts, authenticated with bearer tokens
+	apiHandler := handlers.NewAPIHandler(chatHandler, models.NewUserService(db), models.NewTokenService(db))
+	apiHandler.Register(e.Group("/api/v1"))
+
 	// Routes
+	// Public share links, read-only and open to anyone with the token
+	e.GET("/share/:token", shareHandler.ShowShare)
+	e.GET("/share/:token/images/:key", shareHandler.ServeSharedImage)
+
 	// Guest routes (redirect to dashboard if authenticated)
 	guest := e.Group("")
 	guest.Use(handlers.GuestMiddleware)
@@ -80,9 +125,32 @@ func main() {
 	protected.Use(handlers.AuthMiddleware)
 	protected.GET("/", chatHandler.ShowMainInterface)          // Main chat interface
 	protected.GET("/dashboard", chatHandler.ShowMainInterface) // Redirect old dashboard
+	protected.GET("/chats", chatHandler.ListChats)
+	protected.GET("/search", searchHandler.Search)
+	protected.GET("/import", importHandler.ShowImport)
+	protected.POST("/import", importHandler.Import)
 	protected.GET("/chat/:tree_id", chatHandler.GetChatMessages)
 	protected.POST("/chat", chatHandler.CreateNewChat)
 	protected.POST("/chat/:tree_id/message", chatHandler.SendMessage)
+	protected.POST("/chat/:tree_id/model", chatHandler.SwitchModel)
+	protected.POST("/chat/:tree_id/rename", chatHandler.RenameTree)
+	protected.DELETE("/chat/:tree_id", chatHandler.DeleteTree)
+	protected.POST("/chat/:tree_id/pin", chatHandler.TogglePinned)
+	protected.POST("/chat/:tree_id/archive", chatHandler.ToggleArchived)
+	protected.POST("/chat/:tree_id/duplicate", chatHandler.DuplicateTree)
+	protected.GET("/chat/:tree_id/export", chatHandler.ExportChat)
+	protected.GET("/chat/:tree_id/documents", documentHandler.ListDocuments)
+	protected.POST("/chat/:tree_id/documents", documentHandler.UploadDocument)
+	protected.DELETE("/chat/:tree_id/documents/:document_id", documentHandler.DeleteDocument)
+	protected.GET("/chat/:tree_id/shares", shareHandler.ListShares)
+	protected.POST("/chat/:tree_id/shares", shareHandler.CreateShare)
+	protected.DELETE("/chat/:tree_id/shares/:share_id", shareHandler.RevokeShare)
+	protected.POST("/chat/:tree_id/messages/:message_id/edit", chatHandler.EditMessage)
+	protected.POST("/chat/:tree_id/messages/:message_id/regenerate", chatHandler.RegenerateMessage)
+	protected.POST("/chat/:tree_id/messages/:message_id/sibling", chatHandler.SwitchSibling)
+	protected.GET("/chat/:tree_id/stream/:message_id", chatHandler.StreamReply)
+	protected.GET("/chat/:tree_id/images/:key", chatHandler.ServeImage)
+	protected.POST("/share/:token/fork", shareHandler.ForkShare)
 	protected.POST("/logout", authHandler.Logout)
 
 	// Start server
@@ -117,6 +185,42 @@ func runMigrations(dsn string) error {
 	return nil
 }
 
+// newProviderRegistry registers every LLM provider that has configuration.
+// The offline fake provider is always available.
+func newProviderRegistry() *llm.Registry {
+	registry := llm.NewRegistry()
+	registry.Register(llm.NewFakeProvider())
+
+	// OPENAI_BASE_URL alone is enough for keyless local servers such as
+	// vLLM, LM Studio or llama.cpp
+	if key, baseURL := os.Getenv("OPENAI_API_KEY"), os.Getenv("OPENAI_BASE_URL"); key != "" || baseURL != "" {
+		registry.Register(llm.NewOpenAIProvider("openai", baseURL, key))
+	}
+	if key := os.Getenv("OPENROUTER_API_KEY"); key != "" {
+		registry.Register(llm.NewOpenAIProvider("openrouter", "https://openrouter.ai/api/v1", key))
+	}
+	if key := os.Getenv("ANTHROPIC_API_KEY"); key != "" {
+		registry.Register(llm.NewAnthropicProvider(os.Getenv("ANTHROPIC_BASE_URL"), key))
+	}
+	if key := os.Getenv("GEMINI_API_KEY"); key != "" {
+		registry.Register(llm.NewGeminiProvider(os.Getenv("GEMINI_BASE_URL"), key))
+	}
+	if baseURL := os.Getenv("OLLAMA_BASE_URL"); baseURL != "" {
+		registry.Register(llm.NewOllamaProvider(baseURL))
+	}
+
+	return registry
+}
+
+// newEmbedder picks the embedder for semantic search. EMBEDDER=openai uses
+// the embeddings endpoint of OPENAI_BASE_URL, anything else hashes locally.
+func newEmbedder() llm.Embedder {
+	if os.Getenv("EMBEDDER") == "openai" {
+		return llm.NewOpenAIEmbedder(os.Getenv("OPENAI_BASE_URL"), os.Getenv("OPENAI_API_KEY"), os.Getenv("EMBEDDING_MODEL"))
+	}
+	return llm.NewHashEmbedder(llm.DefaultHashDimensions)
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -0,0 +1,81 @@
+package documents
+
+import "strings"
+
+const (
+	DefaultChunkSize    = 1000 // Runes
+	DefaultChunkOverlap = 200
+)
+
+// Chunk splits text into pieces of at most size runes. Paragraphs are kept
+// together where they fit, longer ones are cut at word boundaries. Each
+// chunk repeats up to overlap runes from the end of the previous one so
+// sentences at the border are found from both sides.
+func Chunk(text string, size, overlap int) []string {
+	if overlap >= size {
+		overlap = size / 4
+	}
+
+	var chunks []string
+	var current []rune
+	pending := false // current holds text beyond the overlap
+	flush := func() {
+		if chunk := strings.TrimSpace(string(current)); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		current = tail(current, overlap)
+		pending = false
+	}
+
+	for _, para := range strings.Split(text, "\n\n") {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		}
+		for _, piece := range splitLong([]rune(para), size-overlap-2) {
+			if len(current)+len(piece)+2 > size && pending {
+				flush()
+			}
+			if len(current) > 0 {
+				current = append(current, '\n', '\n')
+			}
+			current = append(current, piece...)
+			pending = true
+		}
+	}
+	if pending {
+		flush()
+	}
+
+	return chunks
+}
+
+// splitLong cuts a paragraph into pieces of at most max runes, preferring
+// to cut at a space
+func splitLong(para []rune, max int) [][]rune {
+	var pieces [][]rune
+	for len(para) > max {
+		cut := max
+		for i := max; i > max/2; i-- {
+			if para[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+		pieces = append(pieces, para[:cut])
+		para = []rune(strings.TrimSpace(string(para[cut:])))
+	}
+	return append(pieces, para)
+}
+
+// tail returns the last n runes, starting at a word boundary
+func tail(r []rune, n int) []rune {
+	if len(r) <= n {
+		return append([]rune(nil), r...)
+	}
+	t := r[len(r)-n:]
+	if i := strings.IndexRune(string(t), ' '); i >= 0 {
+		t = []rune(strings.TrimSpace(string(t)[i:]))
+	}
+	return append([]rune(nil), t...)
+}
@@ -0,0 +1,77 @@
+// Package documents turns uploaded files into chunks of text and retrieves
+// the chunks relevant to a question.
+package documents
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+const (
+	MimePDF      = "application/pdf"
+	MimeMarkdown = "text/markdown"
+	MimeText     = "text/plain"
+)
+
+var (
+	ErrUnsupportedType = errors.New("only PDF, Markdown and text files are supported")
+	ErrNoText          = errors.New("the file contains no extractable text")
+)
+
+// DetectType works out the file type from its content, falling back to the
+// extension to tell Markdown from plain text.
+func DetectType(filename string, data []byte) (string, error) {
+	sniffed := http.DetectContentType(data)
+	switch {
+	case sniffed == MimePDF:
+		return MimePDF, nil
+	case strings.HasPrefix(sniffed, "text/plain"):
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".md", ".markdown":
+			return MimeMarkdown, nil
+		}
+		return MimeText, nil
+	}
+	return "", ErrUnsupportedType
+}
+
+// Extract returns the text of a file of the given type
+func Extract(mimeType string, data []byte) (string, error) {
+	var text string
+	switch mimeType {
+	case MimePDF:
+		r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return "", err
+		}
+		plain, err := r.GetPlainText()
+		if err != nil {
+			return "", err
+		}
+		b, err := io.ReadAll(plain)
+		if err != nil {
+			return "", err
+		}
+		text = string(b)
+	case MimeMarkdown, MimeText:
+		if !utf8.Valid(data) {
+			return "", ErrUnsupportedType
+		}
+		text = string(data)
+	default:
+		return "", ErrUnsupportedType
+	}
+
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+	if text == "" {
+		return "", ErrNoText
+	}
+	return text, nil
+}
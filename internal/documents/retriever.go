@@ -0,0 +1,106 @@
+package documents
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"t3sesame/internal/llm"
+	"t3sesame/internal/models"
+)
+
+const (
+	retrieveLimit  = 4
+	embedBatchSize = 64
+)
+
+var citationRef = regexp.MustCompile(`\[(\d+)\]`)
+
+// Retriever indexes a tree's documents and finds the chunks relevant to a
+// question
+type Retriever struct {
+	documents *models.DocumentService
+	embedder  llm.Embedder
+}
+
+func NewRetriever(documents *models.DocumentService, embedder llm.Embedder) *Retriever {
+	return &Retriever{documents: documents, embedder: embedder}
+}
+
+// Add chunks and embeds the text of a document and stores it
+func (r *Retriever) Add(ctx context.Context, doc *models.Document, text string) error {
+	chunks := Chunk(text, DefaultChunkSize, DefaultChunkOverlap)
+
+	embeddings := make([][]float32, 0, len(chunks))
+	for start := 0; start < len(chunks); start += embedBatchSize {
+		end := min(start+embedBatchSize, len(chunks))
+		vectors, err := r.embedder.Embed(ctx, chunks[start:end])
+		if err != nil {
+			return err
+		}
+		embeddings = append(embeddings, vectors...)
+	}
+
+	return r.documents.CreateDocument(doc, chunks, r.embedder.Name(), embeddings)
+}
+
+// Retrieve returns the chunks of the tree's documents closest to the query.
+// Trees without documents return nothing.
+func (r *Retriever) Retrieve(ctx context.Context, treeID int, query string) ([]models.DocumentChunk, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, nil
+	}
+	// Most trees have no documents, and embedding may be a paid API call
+	found, err := r.documents.HasChunks(treeID, r.embedder.Name())
+	if err != nil || !found {
+		return nil, err
+	}
+
+	vectors, err := r.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.documents.SearchChunks(treeID, r.embedder.Name(), vectors[0], retrieveLimit)
+}
+
+// SourcesPrompt numbers the chunks for the system prompt and asks the model
+// to cite them by number
+func SourcesPrompt(chunks []models.DocumentChunk) string {
+	var b strings.Builder
+	b.WriteString("Answer using the following excerpts from documents the user attached when they are relevant. ")
+	b.WriteString("Cite the excerpts you use by their number in square brackets, e.g. [1].\n")
+	for i, c := range chunks {
+		fmt.Fprintf(&b, "\n[%d] %s\n%s\n", i+1, c.Filename, c.Content)
+	}
+	return b.String()
+}
+
+// Citations picks the chunks the reply cites as [n]. Models that cite
+// nothing still had every chunk in their context, so all of them are
+// returned then.
+func Citations(chunks []models.DocumentChunk, reply string) []models.ContentPart {
+	cited := map[int]bool{}
+	for _, m := range citationRef.FindAllStringSubmatch(reply, -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil && n >= 1 && n <= len(chunks) {
+			cited[n] = true
+		}
+	}
+
+	var parts []models.ContentPart
+	for i, c := range chunks {
+		if len(cited) > 0 && !cited[i+1] {
+			continue
+		}
+		parts = append(parts, models.ContentPart{
+			Type:    models.PartCitation,
+			Text:    c.Content,
+			ChunkID: c.ID,
+			Source:  c.Filename,
+			Label:   i + 1,
+		})
+	}
+	return parts
+}
@@ -0,0 +1,123 @@
+// Package export writes conversations to portable files.
+package export
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"t3sesame/internal/models"
+)
+
+// Format identifies JSON exports, Version changes whenever a reader of the
+// previous version would misread a new file
+const (
+	Format  = "t3sesame.conversation"
+	Version = 1
+)
+
+// Document is the JSON export of a tree with every branch. Message IDs are
+// only meaningful within the file, importers assign new ones.
+type Document struct {
+	Format       string       `json:"format"`
+	Version      int          `json:"version"`
+	ExportedAt   time.Time    `json:"exported_at"`
+	Conversation Conversation `json:"conversation"`
+	Messages     []Message    `json:"messages"`
+}
+
+type Conversation struct {
+	Title        string    `json:"title"`
+	Model        string    `json:"model,omitempty"` // "provider/name"
+	Pinned       bool      `json:"pinned"`
+	Archived     bool      `json:"archived"`
+	ActiveLeafID *int      `json:"active_leaf_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type Message struct {
+	ID         int                `json:"id"`
+	ParentID   *int               `json:"parent_id"`
+	Role       string             `json:"role"`
+	Parts      models.Parts       `json:"parts"`
+	Model      string             `json:"model,omitempty"` // "provider/name"
+	Generation *models.Generation `json:"generation,omitempty"`
+	CreatedAt  time.Time          `json:"created_at"`
+}
+
+// NewDocument builds the export of a tree. modelRefs maps model IDs to their
+// "provider/name" reference.
+func NewDocument(tree *models.MessageTree, messages []models.Message, modelRefs map[int]string) *Document {
+	doc := &Document{
+		Format:     Format,
+		Version:    Version,
+		ExportedAt: time.Now().UTC(),
+		Conversation: Conversation{
+			Title:        tree.Title,
+			Pinned:       tree.Pinned,
+			Archived:     tree.Archived,
+			ActiveLeafID: tree.ActiveLeafID,
+			CreatedAt:    tree.CreatedAt,
+			UpdatedAt:    tree.UpdatedAt,
+		},
+		Messages: make([]Message, 0, len(messages)),
+	}
+	if tree.AIID != nil {
+		doc.Conversation.Model = modelRefs[*tree.AIID]
+	}
+
+	for _, msg := range messages {
+		m := Message{
+			ID:        msg.ID,
+			ParentID:  msg.ParentMessageID,
+			Role:      msg.Role,
+			Parts:     msg.Parts,
+			CreatedAt: msg.CreatedAt,
+		}
+		if msg.ModelID != nil {
+			m.Model = modelRefs[*msg.ModelID]
+		}
+		if !msg.Generation.IsZero() {
+			g := msg.Generation
+			m.Generation = &g
+		}
+		doc.Messages = append(doc.Messages, m)
+	}
+
+	return doc
+}
+
+func WriteJSON(w io.Writer, doc *Document) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// ActivePath picks the branch ending at the tree's active leaf out of all
+// of its messages, first message first
+func ActivePath(tree *models.MessageTree, messages []models.Message) []models.Message {
+	if tree.ActiveLeafID == nil {
+		return nil
+	}
+	byID := make(map[int]models.Message, len(messages))
+	for _, msg := range messages {
+		byID[msg.ID] = msg
+	}
+
+	var path []models.Message
+	for id := tree.ActiveLeafID; id != nil; {
+		msg, ok := byID[*id]
+		if !ok {
+			break
+		}
+		path = append(path, msg)
+		id = msg.ParentMessageID
+	}
+
+	// Walked from the leaf up, so reverse
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
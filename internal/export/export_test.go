@@ -0,0 +1,141 @@
+package export_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"t3sesame/internal/export"
+	"t3sesame/internal/importer"
+	"t3sesame/internal/models"
+)
+
+func intPtr(n int) *int { return &n }
+
+// branchedTree is a question answered twice, with a follow-up on the first
+// answer. The active branch is the second answer.
+func branchedTree() (*models.MessageTree, []models.Message) {
+	created := time.Date(2024, 6, 1, 11, 0, 0, 0, time.UTC)
+	message := func(id int, parent *int, role, text string) models.Message {
+		return models.Message{
+			ID:              id,
+			ParentMessageID: parent,
+			Role:            role,
+			Content:         text,
+			Parts:           models.Parts{{Type: models.PartText, Text: text}},
+			CreatedAt:       created.Add(time.Duration(id) * time.Minute),
+		}
+	}
+
+	messages := []models.Message{
+		message(1, nil, models.RoleUser, "Question"),
+		message(2, intPtr(1), models.RoleAssistant, "First answer"),
+		message(3, intPtr(2), models.RoleUser, "Follow-up on the first"),
+		message(4, intPtr(1), models.RoleAssistant, "Second answer"),
+	}
+	messages[3].ModelID = intPtr(7)
+	messages[3].Generation = models.Generation{PromptTokens: 5, CompletionTokens: 2, FinishReason: "stop"}
+
+	tree := &models.MessageTree{
+		ID:           42,
+		Title:        "Branches",
+		AIID:         intPtr(7),
+		ActiveLeafID: intPtr(4),
+		CreatedAt:    created,
+		UpdatedAt:    created.Add(time.Hour),
+	}
+	return tree, messages
+}
+
+func TestActivePath(t *testing.T) {
+	tree, messages := branchedTree()
+
+	var ids []int
+	for _, msg := range export.ActivePath(tree, messages) {
+		ids = append(ids, msg.ID)
+	}
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 4 {
+		t.Errorf("ActivePath = %v, want [1 4]", ids)
+	}
+
+	tree.ActiveLeafID = nil
+	if path := export.ActivePath(tree, messages); path != nil {
+		t.Errorf("ActivePath without a leaf = %v", path)
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	tree, messages := branchedTree()
+	var buf bytes.Buffer
+	if err := export.WriteMarkdown(&buf, tree, export.ActivePath(tree, messages)); err != nil {
+		t.Fatal(err)
+	}
+
+	md := buf.String()
+	for _, want := range []string{"# Branches", "### You\n\nQuestion", "### Assistant\n\nSecond answer"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Markdown lacks %q:\n%s", want, md)
+		}
+	}
+	// Other branches are left out
+	for _, other := range []string{"First answer", "Follow-up"} {
+		if strings.Contains(md, other) {
+			t.Errorf("Markdown contains %q from another branch:\n%s", other, md)
+		}
+	}
+}
+
+// A JSON export keeps every branch and imports back to the same tree
+func TestJSONRoundTrip(t *testing.T) {
+	tree, messages := branchedTree()
+	var buf bytes.Buffer
+	doc := export.NewDocument(tree, messages, map[int]string{7: "openai/gpt-4o"})
+	if err := export.WriteJSON(&buf, doc); err != nil {
+		t.Fatal(err)
+	}
+
+	source, convs, err := importer.Parse(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source != importer.SourceT3Sesame || len(convs) != 1 {
+		t.Fatalf("Parse = %q with %d conversations", source, len(convs))
+	}
+	conv := convs[0]
+	if conv.Err != nil {
+		t.Fatalf("Err = %v", conv.Err)
+	}
+
+	if conv.Title != tree.Title || conv.ModelRef != "openai/gpt-4o" ||
+		!conv.CreatedAt.Equal(tree.CreatedAt) || !conv.UpdatedAt.Equal(tree.UpdatedAt) {
+		t.Errorf("conversation = %q, %q, %v, %v", conv.Title, conv.ModelRef, conv.CreatedAt, conv.UpdatedAt)
+	}
+	if conv.ActiveLeafID == nil || *conv.ActiveLeafID != *tree.ActiveLeafID {
+		t.Errorf("ActiveLeafID = %v, want %d", conv.ActiveLeafID, *tree.ActiveLeafID)
+	}
+	if conv.Branches() != 2 {
+		t.Errorf("Branches = %d, want 2", conv.Branches())
+	}
+
+	if len(conv.Messages) != len(messages) {
+		t.Fatalf("got %d messages, want %d", len(conv.Messages), len(messages))
+	}
+	for i, got := range conv.Messages {
+		want := messages[i]
+		if got.ID != want.ID || !sameParent(got.ParentID, want.ParentMessageID) || got.Role != want.Role ||
+			got.Parts.Text() != want.Content || !got.CreatedAt.Equal(want.CreatedAt) || got.Generation != want.Generation {
+			t.Errorf("message %d = %+v, want %+v", want.ID, got, want)
+		}
+	}
+	if conv.Messages[3].ModelRef != "openai/gpt-4o" {
+		t.Errorf("message 4 model = %q", conv.Messages[3].ModelRef)
+	}
+}
+
+func sameParent(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
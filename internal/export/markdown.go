@@ -0,0 +1,64 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"t3sesame/internal/models"
+)
+
+// WriteMarkdown writes the given branch as a readable transcript
+func WriteMarkdown(w io.Writer, tree *models.MessageTree, path []models.Message) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", tree.Title)
+	fmt.Fprintf(&b, "_Exported from T3Sesame. Created %s._\n", tree.CreatedAt.Format("January 2, 2006 at 3:04 PM"))
+
+	for _, msg := range path {
+		b.WriteString("\n---\n\n")
+		fmt.Fprintf(&b, "### %s\n\n", speaker(msg))
+
+		for _, part := range msg.Parts {
+			switch part.Type {
+			case models.PartText:
+				b.WriteString(part.Text + "\n\n")
+			case models.PartImage:
+				b.WriteString("_[image attachment]_\n\n")
+			case models.PartToolCall:
+				fmt.Fprintf(&b, "_Called `%s(%s)`_\n\n", part.ToolName, part.Arguments)
+			case models.PartToolResult:
+				fmt.Fprintf(&b, "```\n%s\n```\n\n", part.Text)
+			}
+		}
+
+		var sources []string
+		for _, part := range msg.Parts {
+			if part.Type == models.PartCitation {
+				sources = append(sources, fmt.Sprintf("[%d] %s", part.Label, part.Source))
+			}
+		}
+		if len(sources) > 0 {
+			b.WriteString("Sources: " + strings.Join(sources, ", ") + "\n\n")
+		}
+
+		fmt.Fprintf(&b, "<sub>%s</sub>\n", msg.CreatedAt.Format("Jan 2, 2006 3:04 PM"))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func speaker(msg models.Message) string {
+	switch msg.Role {
+	case models.RoleUser:
+		return "You"
+	case models.RoleAssistant:
+		if msg.ModelName != "" {
+			return "Assistant (" + msg.ModelName + ")"
+		}
+		return "Assistant"
+	case models.RoleTool:
+		return "Tool"
+	}
+	return "System"
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"t3sesame/internal/models"
+	"time"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+)
+
+// APIHandler serves the versioned JSON API under /api/v1. It shares the
+// chat logic with ChatHandler but speaks JSON and authenticates with bearer
+// tokens instead of the session.
+type APIHandler struct {
+	chat         *ChatHandler
+	userService  *models.UserService
+	tokenService *models.TokenService
+}
+
+func NewAPIHandler(chat *ChatHandler, userService *models.UserService, tokenService *models.TokenService) *APIHandler {
+	return &APIHandler{
+		chat:         chat,
+		userService:  userService,
+		tokenService: tokenService,
+	}
+}
+
+// apiRoute is one API endpoint. The table in routes both registers the
+// handlers and generates the OpenAPI document, so the two cannot drift.
+type apiRoute struct {
+	id      string // OpenAPI operationId
+	method  string
+	path    string // Echo syntax, relative to /api/v1
+	summary string
+	handler echo.HandlerFunc
+	public  bool // Served without a token
+	query   []apiParam
+	request any // Zero value of the JSON body type, nil for none
+	// Zero value of the JSON response type, nil for 204 No Content
+	response any
+	status   int
+	stream   bool // Also answers text/event-stream
+}
+
+type apiParam struct {
+	name        string
+	typ         string
+	description string
+}
+
+var pageParams = []apiParam{
+	{"cursor", "string", "next_cursor of the previous page"},
+	{"limit", "integer", "Page size, 1 to 100, default 20"},
+}
+
+func (h *APIHandler) routes() []apiRoute {
+	return []apiRoute{
+		{id: "createToken", method: http.MethodPost, path: "/tokens", summary: "Create an API token with your email and password",
+			handler: h.CreateToken, public: true, request: apiTokenRequest{}, response: apiTokenCreated{}, status: http.StatusCreated},
+		{id: "revokeToken", method: http.MethodDelete, path: "/tokens/current", summary: "Revoke the token used for this request",
+			handler: h.RevokeToken, status: http.StatusNoContent},
+		{id: "listTrees", method: http.MethodGet, path: "/trees", summary: "List conversations, most recently updated first",
+			handler: h.ListTrees, response: apiTreePage{}, status: http.StatusOK,
+			query: append([]apiParam{{"archived", "boolean", "Include archived conversations"}}, pageParams...)},
+		{id: "createTree", method: http.MethodPost, path: "/trees", summary: "Start a conversation",
+			handler: h.CreateTree, request: apiTreeRequest{}, response: apiTree{}, status: http.StatusCreated},
+		{id: "getTree", method: http.MethodGet, path: "/trees/:tree_id", summary: "Get a conversation",
+			handler: h.GetTree, response: apiTree{}, status: http.StatusOK},
+		{id: "deleteTree", method: http.MethodDelete, path: "/trees/:tree_id", summary: "Delete a conversation and all its messages",
+			handler: h.DeleteTree, status: http.StatusNoContent},
+		{id: "listMessages", method: http.MethodGet, path: "/trees/:tree_id/messages", summary: "List the messages of every branch, oldest first",
+			handler: h.ListMessages, response: apiMessagePage{}, status: http.StatusOK, query: pageParams},
+		{id: "sendMessage", method: http.MethodPost, path: "/trees/:tree_id/messages", summary: "Add a user message, by default to the active branch",
+			handler: h.SendMessage, request: apiMessageRequest{}, response: apiMessage{}, status: http.StatusCreated},
+		{id: "reply", method: http.MethodPost, path: "/trees/:tree_id/messages/:message_id/reply",
+			summary: "Generate the assistant reply to the last user message. With Accept: text/event-stream " +
+				"the reply streams as delta events followed by a done event carrying the saved message.",
+			handler: h.Reply, response: apiMessage{}, status: http.StatusCreated, stream: true},
+		{id: "getOpenAPI", method: http.MethodGet, path: "/openapi.json", summary: "This document",
+			handler: h.OpenAPI, public: true, status: http.StatusOK},
+	}
+}
+
+// Register adds the API routes to a group mounted at /api/v1
+func (h *APIHandler) Register(g *echo.Group) {
+	g.Use(apiErrors)
+	for _, r := range h.routes() {
+		handler := r.handler
+		if !r.public {
+			handler = h.requireToken(handler)
+		}
+		g.Add(r.method, r.path, handler)
+	}
+}
+
+// OpenAPI serves the API description generated from the route table
+func (h *APIHandler) OpenAPI(c echo.Context) error {
+	return c.JSON(http.StatusOK, openAPIDocument(h.routes()))
+}
+
+// apiError is the body of every failed API response. Code is derived from
+// the status, e.g. "not_found".
+type apiError struct {
+	Error apiErrorBody `json:"error"`
+}
+
+type apiErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func apiFail(c echo.Context, status int, message string) error {
+	return c.JSON(status, apiError{apiErrorBody{Code: errorCode(status), Message: message}})
+}
+
+func errorCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// apiErrors wraps errors Echo raises itself, such as for unknown routes, in
+// the error envelope
+func apiErrors(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		err := next(c)
+		var he *echo.HTTPError
+		if errors.As(err, &he) && !c.Response().Committed {
+			return apiFail(c, he.Code, fmt.Sprint(he.Message))
+		}
+		return err
+	}
+}
+
+// requireToken authenticates a request by its bearer token
+func (h *APIHandler) requireToken(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		secret, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+		if !ok || secret == "" {
+			return apiFail(c, http.StatusUnauthorized, "Missing bearer token")
+		}
+		token, err := h.tokenService.Authenticate(secret)
+		if err != nil {
+			return apiFail(c, http.StatusUnauthorized, "Invalid token")
+		}
+		c.Set("api_token", token)
+		return next(c)
+	}
+}
+
+func apiToken(c echo.Context) *models.APIToken {
+	return c.Get("api_token").(*models.APIToken)
+}
+
+// Page sizes for list endpoints
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+func pageLimit(c echo.Context) (int, bool) {
+	raw := c.QueryParam("limit")
+	if raw == "" {
+		return defaultPageSize, true
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 1 || limit > maxPageSize {
+		return 0, false
+	}
+	return limit, true
+}
+
+// Cursors are opaque to clients. Tree cursors hold the update time and ID
+// of the last tree, message cursors the last message ID.
+
+func encodeTreeCursor(tree models.MessageTree) string {
+	return base64.RawURLEncoding.EncodeToString(
+		[]byte(fmt.Sprintf("%d.%d", tree.UpdatedAt.UnixMicro(), tree.ID)))
+}
+
+func decodeTreeCursor(cursor string) (*models.TreeCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	micros, id, ok := strings.Cut(string(raw), ".")
+	if !ok {
+		return nil, errors.New("malformed cursor")
+	}
+	us, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	treeID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TreeCursor{UpdatedAt: time.UnixMicro(us), ID: treeID}, nil
+}
+
+func encodeMessageCursor(msg models.Message) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(msg.ID)))
+}
+
+func decodeMessageCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(raw))
+}
+
+type apiTokenRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Name     string `json:"name,omitempty"`
+}
+
+// apiTokenCreated is the only time the token secret is returned
+type apiTokenCreated struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Token     string    `json:"token"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateToken exchanges email and password for a bearer token
+func (h *APIHandler) CreateToken(c echo.Context) error {
+	var req apiTokenRequest
+	if err := c.Bind(&req); err != nil {
+		return apiFail(c, http.StatusBadRequest, "Invalid JSON body")
+	}
+	if req.Email == "" || req.Password == "" {
+		return apiFail(c, http.StatusBadRequest, "Email and password are required")
+	}
+
+	user, err := h.userService.GetUserByEmail(req.Email)
+	if err != nil || !h.userService.ValidatePassword(user, req.Password) {
+		return apiFail(c, http.StatusUnauthorized, "Invalid email or password")
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "API token"
+	}
+	if utf8.RuneCountInString(name) > 100 {
+		return apiFail(c, http.StatusBadRequest, "Name can be at most 100 characters")
+	}
+	token, secret, err := h.tokenService.CreateToken(user.ID, name)
+	if err != nil {
+		return apiFail(c, http.StatusInternalServerError, "Failed to create token")
+	}
+
+	return c.JSON(http.StatusCreated, apiTokenCreated{
+		ID:        token.ID,
+		Name:      token.Name,
+		Token:     secret,
+		CreatedAt: token.CreatedAt,
+	})
+}
+
+func (h *APIHandler) RevokeToken(c echo.Context) error {
+	token := apiToken(c)
+	if err := h.tokenService.DeleteToken(token.ID, token.UserID); err != nil {
+		return apiFail(c, http.StatusNotFound, "Token not found")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
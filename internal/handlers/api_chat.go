@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"t3sesame/internal/models"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// apiTree is a conversation as the API shows it
+type apiTree struct {
+	ID           int       `json:"id"`
+	Title        string    `json:"title"`
+	Model        string    `json:"model"` // "provider/name" used for replies
+	ActiveLeafID *int      `json:"active_leaf_id"`
+	Pinned       bool      `json:"pinned"`
+	Archived     bool      `json:"archived"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type apiTreePage struct {
+	Data       []apiTree `json:"data"`
+	NextCursor string    `json:"next_cursor,omitempty"` // Empty on the last page
+}
+
+type apiTreeRequest struct {
+	Title string `json:"title,omitempty"`
+	Model string `json:"model,omitempty"` // "provider/name", the default model when empty
+}
+
+// apiMessage is a message as the API shows it. Branches are rebuilt from
+// parent_id.
+type apiMessage struct {
+	ID         int                `json:"id"`
+	TreeID     int                `json:"tree_id"`
+	ParentID   *int               `json:"parent_id"`
+	Role       string             `json:"role"`
+	Content    string             `json:"content"`
+	Parts      models.Parts       `json:"parts"`
+	ModelName  string             `json:"model_name,omitempty"`
+	Generation *models.Generation `json:"generation,omitempty"`
+	CreatedAt  time.Time          `json:"created_at"`
+}
+
+type apiMessagePage struct {
+	Data       []apiMessage `json:"data"`
+	NextCursor string       `json:"next_cursor,omitempty"` // Empty on the last page
+}
+
+type apiMessageRequest struct {
+	Content string `json:"content"`
+	// Message to answer, the active leaf when omitted. Another message
+	// starts a new branch.
+	ParentID *int `json:"parent_id,omitempty"`
+}
+
+// toAPITree resolves the tree's model through refs, which caches lookups
+// across a page
+func (h *APIHandler) toAPITree(tree models.MessageTree, refs map[int]string) apiTree {
+	ref := h.chat.defaultModel
+	if tree.AIID != nil {
+		if cached, ok := refs[*tree.AIID]; ok {
+			ref = cached
+		} else if m, err := h.chat.modelService.GetModel(*tree.AIID); err == nil {
+			ref = m.Ref()
+			refs[*tree.AIID] = ref
+		}
+	}
+
+	return apiTree{
+		ID:           tree.ID,
+		Title:        tree.Title,
+		Model:        ref,
+		ActiveLeafID: tree.ActiveLeafID,
+		Pinned:       tree.Pinned,
+		Archived:     tree.Archived,
+		CreatedAt:    tree.CreatedAt,
+		UpdatedAt:    tree.UpdatedAt,
+	}
+}
+
+func toAPIMessage(msg models.Message) apiMessage {
+	m := apiMessage{
+		ID:        msg.ID,
+		TreeID:    msg.MessageTreeID,
+		ParentID:  msg.ParentMessageID,
+		Role:      msg.Role,
+		Content:   msg.Content,
+		Parts:     msg.Parts,
+		ModelName: msg.ModelName,
+		CreatedAt: msg.CreatedAt,
+	}
+	if m.Parts == nil {
+		m.Parts = models.Parts{}
+	}
+	if !msg.Generation.IsZero() {
+		g := msg.Generation
+		m.Generation = &g
+	}
+	return m
+}
+
+// apiOwnedTree is ownedTree for the API. When it reports false the error
+// response has been written.
+func (h *APIHandler) apiOwnedTree(c echo.Context) (*models.MessageTree, bool) {
+	treeID, err := strconv.Atoi(c.Param("tree_id"))
+	if err != nil {
+		apiFail(c, http.StatusBadRequest, "Invalid tree ID")
+		return nil, false
+	}
+
+	tree, err := h.chat.chatService.GetMessageTree(treeID, apiToken(c).UserID)
+	if err != nil {
+		apiFail(c, http.StatusNotFound, "Conversation not found")
+		return nil, false
+	}
+
+	return tree, true
+}
+
+func (h *APIHandler) ListTrees(c echo.Context) error {
+	limit, ok := pageLimit(c)
+	if !ok {
+		return apiFail(c, http.StatusBadRequest, "limit must be between 1 and 100")
+	}
+	var after *models.TreeCursor
+	if cursor := c.QueryParam("cursor"); cursor != "" {
+		var err error
+		if after, err = decodeTreeCursor(cursor); err != nil {
+			return apiFail(c, http.StatusBadRequest, "Invalid cursor")
+		}
+	}
+
+	// One extra tree tells whether there is another page
+	includeArchived := c.QueryParam("archived") == "true"
+	trees, err := h.chat.chatService.GetUserMessageTreesPage(apiToken(c).UserID, includeArchived, after, limit+1)
+	if err != nil {
+		return apiFail(c, http.StatusInternalServerError, "Failed to load conversations")
+	}
+
+	page := apiTreePage{Data: []apiTree{}}
+	if len(trees) > limit {
+		trees = trees[:limit]
+		page.NextCursor = encodeTreeCursor(trees[limit-1])
+	}
+	refs := map[int]string{}
+	for _, tree := range trees {
+		page.Data = append(page.Data, h.toAPITree(tree, refs))
+	}
+
+	return c.JSON(http.StatusOK, page)
+}
+
+func (h *APIHandler) CreateTree(c echo.Context) error {
+	var req apiTreeRequest
+	if err := c.Bind(&req); err != nil {
+		return apiFail(c, http.StatusBadRequest, "Invalid JSON body")
+	}
+	title := truncate(strings.Join(strings.Fields(req.Title), " "), maxTitleLength)
+
+	model, err := h.chat.resolveModel(c.Request().Context(), req.Model)
+	if err != nil {
+		return apiFail(c, http.StatusBadRequest, "Unknown model")
+	}
+
+	userID := apiToken(c).UserID
+	tree, err := h.chat.chatService.CreateMessageTree(userID, &model.ID)
+	if err != nil {
+		return apiFail(c, http.StatusInternalServerError, "Failed to create conversation")
+	}
+	if title != "" {
+		if err := h.chat.chatService.RenameTree(tree.ID, userID, title); err != nil {
+			return apiFail(c, http.StatusInternalServerError, "Failed to create conversation")
+		}
+		tree.Title = title
+	}
+
+	return c.JSON(http.StatusCreated, h.toAPITree(*tree, map[int]string{}))
+}
+
+func (h *APIHandler) GetTree(c echo.Context) error {
+	tree, ok := h.apiOwnedTree(c)
+	if !ok {
+		return nil
+	}
+	return c.JSON(http.StatusOK, h.toAPITree(*tree, map[int]string{}))
+}
+
+func (h *APIHandler) DeleteTree(c echo.Context) error {
+	tree, ok := h.apiOwnedTree(c)
+	if !ok {
+		return nil
+	}
+	orphaned, err := h.chat.chatService.DeleteTree(tree.ID, tree.UserID)
+	if err != nil {
+		return apiFail(c, http.StatusNotFound, "Conversation not found")
+	}
+	h.chat.deleteBlobs(c.Request().Context(), orphaned)
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *APIHandler) ListMessages(c echo.Context) error {
+	tree, ok := h.apiOwnedTree(c)
+	if !ok {
+		return nil
+	}
+	limit, ok := pageLimit(c)
+	if !ok {
+		return apiFail(c, http.StatusBadRequest, "limit must be between 1 and 100")
+	}
+	afterID := 0
+	if cursor := c.QueryParam("cursor"); cursor != "" {
+		var err error
+		if afterID, err = decodeMessageCursor(cursor); err != nil {
+			return apiFail(c, http.StatusBadRequest, "Invalid cursor")
+		}
+	}
+
+	messages, err := h.chat.chatService.GetMessagesPage(tree.ID, afterID, limit+1)
+	if err != nil {
+		return apiFail(c, http.StatusInternalServerError, "Failed to load messages")
+	}
+
+	page := apiMessagePage{Data: []apiMessage{}}
+	if len(messages) > limit {
+		messages = messages[:limit]
+		page.NextCursor = encodeMessageCursor(messages[limit-1])
+	}
+	for _, msg := range messages {
+		page.Data = append(page.Data, toAPIMessage(msg))
+	}
+
+	return c.JSON(http.StatusOK, page)
+}
+
+// SendMessage saves a user message. The reply is generated by Reply, as in
+// the browser where the placeholder asks for it.
+func (h *APIHandler) SendMessage(c echo.Context) error {
+	tree, ok := h.apiOwnedTree(c)
+	if !ok {
+		return nil
+	}
+
+	var req apiMessageRequest
+	if err := c.Bind(&req); err != nil {
+		return apiFail(c, http.StatusBadRequest, "Invalid JSON body")
+	}
+	content := strings.TrimSpace(req.Content)
+	if content == "" {
+		return apiFail(c, http.StatusBadRequest, "Message content is required")
+	}
+
+	parentID := tree.ActiveLeafID
+	if req.ParentID != nil {
+		parent, err := h.chat.chatService.GetMessage(*req.ParentID, tree.ID)
+		if err != nil {
+			return apiFail(c, http.StatusBadRequest, "Parent message not found")
+		}
+		parentID = &parent.ID
+	}
+
+	msg := &models.Message{
+		MessageTreeID:   tree.ID,
+		ParentMessageID: parentID,
+		Role:            models.RoleUser,
+		Parts:           models.Parts{{Type: models.PartText, Text: content}},
+	}
+	if err := h.chat.chatService.SaveMessage(msg); err != nil {
+		return apiFail(c, http.StatusInternalServerError, "Failed to save message")
+	}
+
+	return c.JSON(http.StatusCreated, toAPIMessage(*msg))
+}
+
+// Reply generates the answer to a user message at the end of the active
+// branch. It waits for the whole reply unless the client accepts
+// text/event-stream, in which case deltas are streamed as they arrive.
+func (h *APIHandler) Reply(c echo.Context) error {
+	tree, ok := h.apiOwnedTree(c)
+	if !ok {
+		return nil
+	}
+	messageID, err := strconv.Atoi(c.Param("message_id"))
+	if err != nil {
+		return apiFail(c, http.StatusBadRequest, "Invalid message ID")
+	}
+	msg, err := h.chat.chatService.GetMessage(messageID, tree.ID)
+	if err != nil || !msg.IsFromUser() {
+		return apiFail(c, http.StatusNotFound, "Message not found")
+	}
+
+	run, err := h.chat.startReply(c.Request().Context(), tree, msg)
+	switch {
+	case errors.Is(err, errAnswered):
+		return apiFail(c, http.StatusConflict, "Message already answered")
+	case errors.Is(err, errStreaming):
+		return apiFail(c, http.StatusConflict, "Reply is already streaming")
+	case err != nil:
+		return apiFail(c, http.StatusInternalServerError, "No AI model configured")
+	}
+	defer run.finish()
+
+	if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "text/event-stream") {
+		return streamAPIReply(c, run)
+	}
+
+	reply, err := run.generate(c.Request().Context(), func(content, delta string) error {
+		return nil
+	})
+	if errors.Is(err, errSaveReply) {
+		return apiFail(c, http.StatusInternalServerError, replyErrorMessage(err))
+	}
+	if err != nil {
+		return apiFail(c, http.StatusBadGateway, replyErrorMessage(err))
+	}
+
+	return c.JSON(http.StatusCreated, toAPIMessage(*reply))
+}
+
+// streamAPIReply sends "delta" events with {"content": "..."}, then "done"
+// with the saved message or "error" with the error envelope
+func streamAPIReply(c echo.Context, run *replyRun) error {
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set(echo.HeaderCacheControl, "no-cache")
+	w.Header().Set(echo.HeaderConnection, "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	w.Flush()
+
+	send := func(event string, v any) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if err := writeSSE(w, event, string(data)); err != nil {
+			return err
+		}
+		w.Flush()
+		return nil
+	}
+
+	reply, err := run.generate(c.Request().Context(), func(content, delta string) error {
+		return send("delta", map[string]string{"content": delta})
+	})
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, errSaveReply) {
+			status = http.StatusInternalServerError
+		}
+		send("error", apiError{apiErrorBody{Code: errorCode(status), Message: replyErrorMessage(err)}})
+		return nil
+	}
+
+	send("done", toAPIMessage(*reply))
+	return nil
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"t3sesame/internal/models"
+	"testing"
+)
+
+func TestCreateTreeRejectsDisabledModel(t *testing.T) {
+	db := testDB(t)
+	modelService := models.NewModelService(db)
+
+	// The fake provider offers echo, but the catalog has it switched off
+	disabled := &models.Model{Provider: "fake", Name: "echo", DisplayName: "Echo (offline)", Capabilities: []string{}}
+	if err := modelService.UpsertModel(disabled); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		disabled.Enabled = true
+		modelService.UpsertModel(disabled)
+	})
+
+	_, request := testAPI(t, db, newTestChatHandler(t, db, "fake/default"))
+	rec := request(http.MethodPost, "/trees", `{"model": "fake/echo"}`)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	// Unless it is the configured default
+	_, request = testAPI(t, db, newTestChatHandler(t, db, "fake/echo"))
+	rec = request(http.MethodPost, "/trees", `{"model": "fake/echo"}`)
+	expectStatus(t, rec, http.StatusCreated)
+	var tree apiTree
+	if err := json.Unmarshal(rec.Body.Bytes(), &tree); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Model != "fake/echo" {
+		t.Errorf("model = %q, want fake/echo", tree.Model)
+	}
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"t3sesame/internal/images"
+	"t3sesame/internal/llm"
+	"t3sesame/internal/models"
+	"t3sesame/internal/storage"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	maxImageSize        = 10 << 20
+	maxImagesPerMessage = 4
+)
+
+// imageParts stores the images uploaded with a message and returns their
+// parts. Images are refused unless the tree's model can see them. When it
+// reports false the error response has been written.
+func (h *ChatHandler) imageParts(c echo.Context, tree *models.MessageTree) ([]models.ContentPart, bool) {
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["images"]) == 0 {
+		// Plain form posts carry no images
+		return nil, true
+	}
+	files := form.File["images"]
+	if len(files) > maxImagesPerMessage {
+		c.String(http.StatusBadRequest, fmt.Sprintf("At most %d images can be attached to a message", maxImagesPerMessage))
+		return nil, false
+	}
+
+	model, err := h.treeModel(c.Request().Context(), tree)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "No AI model configured")
+		return nil, false
+	}
+	if !model.HasCapability(models.CapabilityVision) {
+		c.String(http.StatusBadRequest, model.DisplayName+" cannot read images. Switch to a vision model to attach images.")
+		return nil, false
+	}
+
+	var parts []models.ContentPart
+	for _, fh := range files {
+		part, err := h.storeImage(c.Request().Context(), fh)
+		var rejected *rejectedImage
+		if errors.As(err, &rejected) {
+			h.deleteImages(c.Request().Context(), parts)
+			c.String(rejected.status, rejected.message)
+			return nil, false
+		}
+		if err != nil {
+			log.Printf("store image %s for tree %d: %v", fh.Filename, tree.ID, err)
+			h.deleteImages(c.Request().Context(), parts)
+			c.String(http.StatusInternalServerError, "Failed to store image")
+			return nil, false
+		}
+		parts = append(parts, part)
+	}
+
+	return parts, true
+}
+
+// rejectedImage is an upload the user has to fix
+type rejectedImage struct {
+	status  int
+	message string
+}
+
+func (e *rejectedImage) Error() string {
+	return e.message
+}
+
+// storeImage validates an upload by its content and stores it together
+// with a thumbnail
+func (h *ChatHandler) storeImage(ctx context.Context, fh *multipart.FileHeader) (models.ContentPart, error) {
+	name := filepath.Base(fh.Filename)
+	if fh.Size > maxImageSize {
+		return models.ContentPart{}, &rejectedImage{http.StatusRequestEntityTooLarge, name + " is larger than 10 MB"}
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return models.ContentPart{}, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxImageSize))
+	if err != nil {
+		return models.ContentPart{}, err
+	}
+
+	mimeType, ext, err := images.Detect(data)
+	if err != nil {
+		return models.ContentPart{}, &rejectedImage{http.StatusUnsupportedMediaType, name + ": " + err.Error()}
+	}
+	thumbnail, err := images.Thumbnail(data)
+	if errors.Is(err, images.ErrTooLarge) {
+		return models.ContentPart{}, &rejectedImage{http.StatusRequestEntityTooLarge, name + ": " + err.Error()}
+	}
+	if err != nil {
+		return models.ContentPart{}, &rejectedImage{http.StatusUnprocessableEntity, name + " could not be decoded"}
+	}
+
+	part := models.ContentPart{
+		Type:         models.PartImage,
+		ImageRef:     storage.NewKey(ext),
+		ThumbnailRef: storage.NewKey("jpg"),
+		MimeType:     mimeType,
+	}
+	if err := h.blobs.Put(ctx, part.ImageRef, bytes.NewReader(data)); err != nil {
+		return models.ContentPart{}, err
+	}
+	if err := h.blobs.Put(ctx, part.ThumbnailRef, bytes.NewReader(thumbnail)); err != nil {
+		h.deleteBlobs(ctx, []string{part.ImageRef})
+		return models.ContentPart{}, err
+	}
+
+	return part, nil
+}
+
+// deleteImages removes stored images that did not end up in a message
+func (h *ChatHandler) deleteImages(ctx context.Context, parts []models.ContentPart) {
+	var keys []string
+	for _, part := range parts {
+		keys = append(keys, part.ImageRef, part.ThumbnailRef)
+	}
+	h.deleteBlobs(ctx, keys)
+}
+
+// deleteBlobs removes blobs nothing refers to any more. Failures only leave
+// garbage behind, so they are logged and otherwise ignored.
+func (h *ChatHandler) deleteBlobs(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := h.blobs.Delete(ctx, key); err != nil {
+			log.Printf("delete blob %s: %v", key, err)
+		}
+	}
+}
+
+// loadImage reads an image part back for a provider request
+func (h *ChatHandler) loadImage(ctx context.Context, part models.ContentPart) (llm.Image, error) {
+	r, err := h.blobs.Get(ctx, part.ImageRef)
+	if err != nil {
+		return llm.Image{}, err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return llm.Image{}, err
+	}
+	return llm.Image{MimeType: part.MimeType, Data: data}, nil
+}
+
+// ServeImage returns an image or thumbnail attached to a message in the tree
+func (h *ChatHandler) ServeImage(c echo.Context) error {
+	tree, ok := ownedTree(c, h.chatService)
+	if !ok {
+		return nil
+	}
+
+	key := c.Param("key")
+	if !storage.ValidKey(key) {
+		return c.String(http.StatusNotFound, "Image not found")
+	}
+	found, err := h.chatService.TreeHasBlob(tree.ID, key)
+	if err != nil || !found {
+		return c.String(http.StatusNotFound, "Image not found")
+	}
+
+	r, err := h.blobs.Get(c.Request().Context(), key)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Image not found")
+	}
+	defer r.Close()
+
+	// Keys are random and never reused, so the content never changes
+	c.Response().Header().Set(echo.HeaderCacheControl, "private, max-age=31536000, immutable")
+	c.Response().Header().Set("X-Content-Type-Options", "nosniff")
+	return c.Stream(http.StatusOK, imageContentType(key), r)
+}
+
+func imageContentType(key string) string {
+	switch filepath.Ext(key) {
+	case ".png":
+		return "image/png"
+	case ".jpg":
+		return "image/jpeg"
+	case ".gif":
+		return "image/gif"
+	case ".webp":
+		return "image/webp"
+	}
+	return "application/octet-stream"
+}
@@ -1,9 +1,18 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
+	"t3sesame/internal/documents"
+	"t3sesame/internal/llm"
 	"t3sesame/internal/models"
+	"t3sesame/internal/storage"
 	"t3sesame/internal/templates"
 
 	"github.com/labstack/echo-contrib/session"
@@ -11,26 +20,64 @@ import (
 )
 
 type ChatHandler struct {
-	chatService *models.ChatService
+	chatService  *models.ChatService
+	modelService *models.ModelService
+	providers    *llm.Registry
+	retriever    *documents.Retriever
+	blobs        storage.BlobStore
+	defaultModel string
+	titleModel   string // Cheap model for titles, empty uses the tree's model
+
+	// Message IDs whose reply is currently being streamed
+	mu        sync.Mutex
+	streaming map[int]bool
 }
 
-func NewChatHandler(chatService *models.ChatService) *ChatHandler {
+func NewChatHandler(chatService *models.ChatService, modelService *models.ModelService, providers *llm.Registry, retriever *documents.Retriever, blobs storage.BlobStore, defaultModel, titleModel string) *ChatHandler {
 	return &ChatHandler{
-		chatService: chatService,
+		chatService:  chatService,
+		modelService: modelService,
+		providers:    providers,
+		retriever:    retriever,
+		blobs:        blobs,
+		defaultModel: defaultModel,
+		titleModel:   titleModel,
+		streaming:    make(map[int]bool),
 	}
 }
 
+// ShowMainInterface renders the app. ?chat=ID opens that conversation.
 func (h *ChatHandler) ShowMainInterface(c echo.Context) error {
 	sess, _ := session.Get("session", c)
 	userID := sess.Values["user_id"].(int)
 	username := sess.Values["username"].(string)
 
-	trees, err := h.chatService.GetUserMessageTrees(userID)
+	trees, err := h.chatService.GetUserMessageTrees(userID, false)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to load conversations")
+	}
+
+	// Unreachable providers come back marked unavailable
+	catalog := h.pickerModels(c.Request().Context())
+
+	openTreeID, _ := strconv.Atoi(c.QueryParam("chat"))
+
+	return templates.MainLayout(username, trees, catalog, h.defaultModel, openTreeID).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// ListChats renders the sidebar list, refreshed when a chat is created or
+// changed. Archived chats are listed with ?archived=true.
+func (h *ChatHandler) ListChats(c echo.Context) error {
+	sess, _ := session.Get("session", c)
+	userID := sess.Values["user_id"].(int)
+
+	includeArchived := c.QueryParam("archived") == "true"
+	trees, err := h.chatService.GetUserMessageTrees(userID, includeArchived)
 	if err != nil {
 		return c.String(http.StatusInternalServerError, "Failed to load conversations")
 	}
 
-	return templates.MainLayout(username, trees).Render(c.Request().Context(), c.Response().Writer)
+	return templates.MessageTreeList(trees).Render(c.Request().Context(), c.Response().Writer)
 }
 
 func (h *ChatHandler) GetChatMessages(c echo.Context) error {
@@ -49,24 +96,101 @@ func (h *ChatHandler) GetChatMessages(c echo.Context) error {
 		return c.String(http.StatusNotFound, "Conversation not found")
 	}
 
-	messages, err := h.chatService.GetMessagesByTreeID(treeID)
+	// Search hits link to a message that may sit on another branch
+	if messageID, err := strconv.Atoi(c.QueryParam("message")); err == nil {
+		if err := h.showMessage(tree, messageID); err != nil {
+			return c.String(http.StatusNotFound, "Message not found")
+		}
+	}
+
+	return h.renderChat(c, tree)
+}
+
+// showMessage makes the branch through a message active, unless it already is
+func (h *ChatHandler) showMessage(tree *models.MessageTree, messageID int) error {
+	msg, err := h.chatService.GetMessage(messageID, tree.ID)
+	if err != nil {
+		return err
+	}
+
+	path, err := h.chatService.GetActivePath(tree.ID)
+	if err != nil {
+		return err
+	}
+	for _, m := range path {
+		if m.ID == msg.ID {
+			return nil
+		}
+	}
+
+	leafID, err := h.chatService.LatestLeaf(msg.ID)
+	if err != nil {
+		return err
+	}
+	if err := h.chatService.SetActiveLeaf(tree.ID, leafID); err != nil {
+		return err
+	}
+	tree.ActiveLeafID = &leafID
+	return nil
+}
+
+// renderChat renders the active branch of a tree. A trailing user message
+// without reply gets a streaming placeholder, so generation resumes.
+func (h *ChatHandler) renderChat(c echo.Context, tree *models.MessageTree) error {
+	// Only the active branch is shown
+	messages, err := h.chatService.GetActivePath(tree.ID)
 	if err != nil {
 		return c.String(http.StatusInternalServerError, "Failed to load messages")
 	}
 
-	return templates.MessageDisplay(*tree, messages).Render(c.Request().Context(), c.Response().Writer)
+	model, err := h.treeModel(c.Request().Context(), tree)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "No AI model configured")
+	}
+	catalog := h.pickerModels(c.Request().Context())
+
+	return templates.MessageDisplay(*tree, messages, catalog, model.Ref()).Render(c.Request().Context(), c.Response().Writer)
 }
 
 func (h *ChatHandler) CreateNewChat(c echo.Context) error {
 	sess, _ := session.Get("session", c)
 	userID := sess.Values["user_id"].(int)
 
-	tree, err := h.chatService.CreateMessageTree(userID)
+	model, err := h.resolveModel(c.Request().Context(), c.FormValue("model"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Unknown model")
+	}
+
+	tree, err := h.chatService.CreateMessageTree(userID, &model.ID)
 	if err != nil {
 		return c.String(http.StatusInternalServerError, "Failed to create new chat")
 	}
+	catalog := h.pickerModels(c.Request().Context())
+
+	return templates.NewChatCreated(*tree, catalog, model.Ref()).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// SwitchModel changes the model answering from now on. Earlier replies keep
+// the model that produced them.
+func (h *ChatHandler) SwitchModel(c echo.Context) error {
+	sess, _ := session.Get("session", c)
+	userID := sess.Values["user_id"].(int)
+
+	treeID, err := strconv.Atoi(c.Param("tree_id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid tree ID")
+	}
+
+	model, err := h.resolveModel(c.Request().Context(), c.FormValue("model"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Unknown model")
+	}
+
+	if err := h.chatService.SetTreeModel(treeID, userID, model.ID); err != nil {
+		return c.String(http.StatusNotFound, "Conversation not found")
+	}
 
-	return templates.NewChatCreated(*tree).Render(c.Request().Context(), c.Response().Writer)
+	return c.NoContent(http.StatusNoContent)
 }
 
 func (h *ChatHandler) SendMessage(c echo.Context) error {
@@ -80,35 +204,350 @@ func (h *ChatHandler) SendMessage(c echo.Context) error {
 	}
 
 	// Verify ownership
-	_, err = h.chatService.GetMessageTree(treeID, userID)
+	tree, err := h.chatService.GetMessageTree(treeID, userID)
 	if err != nil {
 		return c.String(http.StatusNotFound, "Conversation not found")
 	}
 
+	content := strings.TrimSpace(c.FormValue("content"))
+	images, ok := h.imageParts(c, tree)
+	if !ok {
+		return nil
+	}
+	if content == "" && len(images) == 0 {
+		return c.String(http.StatusBadRequest, "Message content is required")
+	}
+
+	// Save user message at the end of the active branch
+	userMsg := &models.Message{
+		MessageTreeID:   treeID,
+		ParentMessageID: tree.ActiveLeafID,
+		Role:            models.RoleUser,
+	}
+	if content != "" {
+		userMsg.Parts = append(userMsg.Parts, models.ContentPart{Type: models.PartText, Text: content})
+	}
+	userMsg.Parts = append(userMsg.Parts, images...)
+	if err := h.chatService.SaveMessage(userMsg); err != nil {
+		h.deleteImages(c.Request().Context(), images)
+		return c.String(http.StatusInternalServerError, "Failed to save message")
+	}
+
+	// The assistant reply is generated by StreamReply once the
+	// placeholder below connects over SSE
+	c.Response().Writer.Write([]byte(`<div>`))
+	templates.MessageBubble(*userMsg).Render(c.Request().Context(), c.Response().Writer)
+	templates.StreamingReply(treeID, userMsg.ID).Render(c.Request().Context(), c.Response().Writer)
+	c.Response().Writer.Write([]byte(`</div>`))
+
+	return nil
+}
+
+// EditMessage saves an edited copy of a past user message as its sibling,
+// leaving the original branch intact. The reply on the new branch is
+// streamed by the placeholder renderChat adds.
+func (h *ChatHandler) EditMessage(c echo.Context) error {
+	tree, original, ok := h.treeMessage(c)
+	if !ok {
+		return nil
+	}
+	if !original.IsFromUser() {
+		return c.String(http.StatusBadRequest, "Only your own messages can be edited")
+	}
+
 	content := c.FormValue("content")
 	if content == "" {
 		return c.String(http.StatusBadRequest, "Message content is required")
 	}
 
-	// Save user message
-	userMsg, err := h.chatService.SaveMessage(treeID, content, false)
-	if err != nil {
+	// Attached images carry over to the edited message
+	edited := &models.Message{
+		MessageTreeID:   tree.ID,
+		ParentMessageID: original.ParentMessageID,
+		Role:            models.RoleUser,
+		Parts:           models.Parts{{Type: models.PartText, Text: content}},
+	}
+	for _, part := range original.Parts {
+		if part.Type == models.PartImage {
+			edited.Parts = append(edited.Parts, part)
+		}
+	}
+	if err := h.chatService.SaveMessage(edited); err != nil {
 		return c.String(http.StatusInternalServerError, "Failed to save message")
 	}
+	tree.ActiveLeafID = &edited.ID
+
+	return h.renderChat(c, tree)
+}
+
+// RegenerateMessage asks for another reply to the user message an assistant
+// message answered. The new reply becomes a sibling of the old one.
+func (h *ChatHandler) RegenerateMessage(c echo.Context) error {
+	tree, msg, ok := h.treeMessage(c)
+	if !ok {
+		return nil
+	}
+	if msg.Role != models.RoleAssistant || msg.ParentMessageID == nil {
+		return c.String(http.StatusBadRequest, "Only assistant replies can be regenerated")
+	}
 
-	// For now, just echo back a simple response
-	// In the next user story, we'll integrate with AI
-	aiResponse := "I received your message: \"" + content + "\". AI integration coming soon!"
-	aiMsg, err := h.chatService.SaveMessage(treeID, aiResponse, true)
+	// With the user message as leaf, renderChat adds a streaming placeholder
+	if err := h.chatService.SetActiveLeaf(tree.ID, *msg.ParentMessageID); err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to regenerate")
+	}
+	tree.ActiveLeafID = msg.ParentMessageID
+
+	return h.renderChat(c, tree)
+}
+
+// SwitchSibling pages to the previous or next sibling of a message and shows
+// the most recent branch below it.
+func (h *ChatHandler) SwitchSibling(c echo.Context) error {
+	tree, msg, ok := h.treeMessage(c)
+	if !ok {
+		return nil
+	}
+
+	siblings, err := h.chatService.GetSiblings(msg)
 	if err != nil {
-		return c.String(http.StatusInternalServerError, "Failed to save AI response")
+		return c.String(http.StatusInternalServerError, "Failed to load messages")
 	}
 
-	// Return both messages
-	c.Response().Writer.Write([]byte(`<div>`))
-	templates.MessageBubble(*userMsg).Render(c.Request().Context(), c.Response().Writer)
-	templates.MessageBubble(*aiMsg).Render(c.Request().Context(), c.Response().Writer)
-	c.Response().Writer.Write([]byte(`</div>`))
+	current := 0
+	for i, sibling := range siblings {
+		if sibling.ID == msg.ID {
+			current = i
+		}
+	}
+	target := current
+	switch c.FormValue("dir") {
+	case "prev":
+		target--
+	case "next":
+		target++
+	default:
+		return c.String(http.StatusBadRequest, "Invalid direction")
+	}
+	if target < 0 || target >= len(siblings) {
+		return c.String(http.StatusBadRequest, "No sibling in that direction")
+	}
 
-	return nil
+	leafID, err := h.chatService.LatestLeaf(siblings[target].ID)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to load messages")
+	}
+	if err := h.chatService.SetActiveLeaf(tree.ID, leafID); err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to switch branch")
+	}
+	tree.ActiveLeafID = &leafID
+
+	return h.renderChat(c, tree)
+}
+
+// treeMessage loads the tree and message named in the route, enforcing
+// ownership. When it reports false the error response has been written.
+func (h *ChatHandler) treeMessage(c echo.Context) (*models.MessageTree, *models.Message, bool) {
+	sess, _ := session.Get("session", c)
+	userID := sess.Values["user_id"].(int)
+
+	treeID, err := strconv.Atoi(c.Param("tree_id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid tree ID")
+		return nil, nil, false
+	}
+	messageID, err := strconv.Atoi(c.Param("message_id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid message ID")
+		return nil, nil, false
+	}
+
+	// Verify ownership
+	tree, err := h.chatService.GetMessageTree(treeID, userID)
+	if err != nil {
+		c.String(http.StatusNotFound, "Conversation not found")
+		return nil, nil, false
+	}
+
+	msg, err := h.chatService.GetMessage(messageID, treeID)
+	if err != nil {
+		c.String(http.StatusNotFound, "Message not found")
+		return nil, nil, false
+	}
+
+	return tree, msg, true
+}
+
+// buildRequest resolves the tree's model and packs the conversation history
+// into a provider request.
+func (h *ChatHandler) buildRequest(ctx context.Context, tree *models.MessageTree, history []models.Message) (llm.Provider, llm.Request, *models.Model, error) {
+	model, err := h.treeModel(ctx, tree)
+	if err != nil {
+		return nil, llm.Request{}, nil, err
+	}
+
+	provider, name, err := h.providers.Resolve(model.Ref())
+	if err != nil {
+		return nil, llm.Request{}, nil, err
+	}
+
+	messages, err := h.toLLMMessages(ctx, history, model.HasCapability(models.CapabilityVision))
+	if err != nil {
+		return nil, llm.Request{}, nil, err
+	}
+
+	return provider, llm.Request{
+		Model:    name,
+		Messages: messages,
+	}, model, nil
+}
+
+// treeModel returns the model selected for a tree. Trees created before
+// model selection existed fall back to the default model.
+func (h *ChatHandler) treeModel(ctx context.Context, tree *models.MessageTree) (*models.Model, error) {
+	if tree.AIID != nil {
+		return h.modelService.GetModel(*tree.AIID)
+	}
+	return h.resolveModel(ctx, "")
+}
+
+var errUnknownModel = errors.New("unknown model")
+
+// resolveModel validates a "provider/model" choice from the picker and returns
+// its catalog entry. Models discovered at runtime are added to the catalog.
+func (h *ChatHandler) resolveModel(ctx context.Context, ref string) (*models.Model, error) {
+	if ref == "" {
+		ref = h.defaultModel
+	}
+	providerName, name, ok := strings.Cut(ref, "/")
+	if !ok {
+		return nil, errUnknownModel
+	}
+	if _, err := h.providers.Get(providerName); err != nil {
+		return nil, err
+	}
+
+	// Enabled catalog entries and the configured default are always allowed,
+	// models an admin disabled never are
+	m, err := h.modelService.GetModelByRef(providerName, name)
+	switch {
+	case err == nil && (m.Enabled || ref == h.defaultModel):
+		return m, nil
+	case err == nil:
+		return nil, errUnknownModel
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+	if ref == h.defaultModel {
+		return h.modelService.EnsureModel(providerName, name, name)
+	}
+
+	// Anything else must be offered by the provider right now
+	for _, p := range h.providers.Discover(ctx) {
+		if p.Provider != providerName || !p.Available {
+			continue
+		}
+		for _, m := range p.Models {
+			if m.ID == name {
+				return h.modelService.EnsureModel(providerName, name, m.DisplayName)
+			}
+		}
+	}
+
+	return nil, errUnknownModel
+}
+
+// pickerModels lists what the model picker offers: the enabled catalog
+// models and the default, the same ones resolveModel accepts without asking
+// the providers. Providers that cannot be reached are marked unavailable.
+func (h *ChatHandler) pickerModels(ctx context.Context) []llm.ProviderModels {
+	enabled, err := h.modelService.GetEnabledModels()
+	if err != nil {
+		log.Printf("load enabled models: %v", err)
+	}
+	defaultProvider, defaultName, _ := strings.Cut(h.defaultModel, "/")
+
+	discovered := h.providers.Discover(ctx)
+	picker := make([]llm.ProviderModels, 0, len(discovered))
+	for _, p := range discovered {
+		offered := llm.ProviderModels{Provider: p.Provider, Available: p.Available, Err: p.Err}
+		hasDefault := false
+		for _, m := range enabled {
+			if m.Provider != p.Provider {
+				continue
+			}
+			offered.Models = append(offered.Models, llm.ModelInfo{ID: m.Name, DisplayName: m.DisplayName})
+			hasDefault = hasDefault || m.Name == defaultName
+		}
+		if p.Provider == defaultProvider && !hasDefault {
+			displayName := defaultName
+			if m, err := h.modelService.GetModelByRef(defaultProvider, defaultName); err == nil {
+				displayName = m.DisplayName
+			}
+			offered.Models = append([]llm.ModelInfo{{ID: defaultName, DisplayName: displayName}}, offered.Models...)
+		}
+		picker = append(picker, offered)
+	}
+	return picker
+}
+
+// toLLMMessages converts history for the providers. Images are only loaded
+// for vision models, others just see the text.
+func (h *ChatHandler) toLLMMessages(ctx context.Context, messages []models.Message, vision bool) ([]llm.Message, error) {
+	out := make([]llm.Message, 0, len(messages))
+	for _, msg := range messages {
+		// Each tool result is its own turn for the providers
+		if msg.Role == models.RoleTool {
+			for _, part := range msg.Parts {
+				if part.Type == models.PartToolResult {
+					out = append(out, llm.Message{Role: llm.RoleTool, Content: part.Text, ToolCallID: part.ToolCallID})
+				}
+			}
+			continue
+		}
+
+		// Reasoning parts are not sent back
+		m := llm.Message{Role: msg.Role, Content: msg.Parts.Text()}
+		for _, part := range msg.Parts {
+			if part.Type == models.PartToolCall {
+				m.ToolCalls = append(m.ToolCalls, llm.ToolCall{ID: part.ToolCallID, Name: part.ToolName, Arguments: part.Arguments})
+			}
+			if part.Type == models.PartImage && vision {
+				img, err := h.loadImage(ctx, part)
+				if errors.Is(err, storage.ErrNotFound) {
+					// The rest of the conversation can still be answered
+					log.Printf("image %s of message %d: %v", part.ImageRef, msg.ID, err)
+					continue
+				}
+				if err != nil {
+					return nil, err
+				}
+				m.Images = append(m.Images, img)
+			}
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// replyParts turns a provider response into message parts. resp is nil when
+// the stream was cut off and only the text so far is known.
+func replyParts(resp *llm.Response, text string) models.Parts {
+	var parts models.Parts
+	if resp != nil && resp.Reasoning != "" {
+		parts = append(parts, models.ContentPart{Type: models.PartReasoning, Text: resp.Reasoning})
+	}
+	if text != "" {
+		parts = append(parts, models.ContentPart{Type: models.PartText, Text: text})
+	}
+	if resp != nil {
+		for _, tc := range resp.ToolCalls {
+			parts = append(parts, models.ContentPart{
+				Type:       models.PartToolCall,
+				ToolCallID: tc.ID,
+				ToolName:   tc.Name,
+				Arguments:  tc.Arguments,
+			})
+		}
+	}
+	return parts
 }
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"context"
+	"t3sesame/internal/models"
+	"testing"
+)
+
+// The picker offers what resolveModel accepts: disabled catalog models are
+// left out unless they are the default
+func TestPickerModels(t *testing.T) {
+	db := testDB(t)
+	modelService := models.NewModelService(db)
+
+	disabled := &models.Model{Provider: "fake", Name: "echo", DisplayName: "Echo (offline)", Capabilities: []string{}}
+	if err := modelService.UpsertModel(disabled); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		disabled.Enabled = true
+		modelService.UpsertModel(disabled)
+	})
+
+	offered := func(h *ChatHandler) bool {
+		for _, p := range h.pickerModels(context.Background()) {
+			for _, m := range p.Models {
+				if p.Provider+"/"+m.ID == "fake/echo" {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	if h := newTestChatHandler(t, db, "fake/default"); offered(h) {
+		t.Error("disabled model offered")
+	}
+	if h := newTestChatHandler(t, db, "fake/echo"); !offered(h) {
+		t.Error("disabled default model not offered")
+	}
+}
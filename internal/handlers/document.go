@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"t3sesame/internal/documents"
+	"t3sesame/internal/models"
+	"t3sesame/internal/templates"
+
+	"github.com/labstack/echo/v4"
+)
+
+const maxDocumentSize = 10 << 20
+
+type DocumentHandler struct {
+	chatService     *models.ChatService
+	documentService *models.DocumentService
+	retriever       *documents.Retriever
+}
+
+func NewDocumentHandler(chatService *models.ChatService, documentService *models.DocumentService, retriever *documents.Retriever) *DocumentHandler {
+	return &DocumentHandler{
+		chatService:     chatService,
+		documentService: documentService,
+		retriever:       retriever,
+	}
+}
+
+// ListDocuments renders the documents panel of a chat
+func (h *DocumentHandler) ListDocuments(c echo.Context) error {
+	tree, ok := ownedTree(c, h.chatService)
+	if !ok {
+		return nil
+	}
+	return h.renderDocuments(c, tree.ID)
+}
+
+// UploadDocument extracts, chunks and embeds an uploaded file. Only the
+// chunks are kept, not the file.
+func (h *DocumentHandler) UploadDocument(c echo.Context) error {
+	tree, ok := ownedTree(c, h.chatService)
+	if !ok {
+		return nil
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return c.String(http.StatusBadRequest, "No file uploaded")
+	}
+	if fh.Size > maxDocumentSize {
+		return c.String(http.StatusRequestEntityTooLarge, "Files can be at most 10 MB")
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Failed to read file")
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxDocumentSize))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Failed to read file")
+	}
+
+	filename := filepath.Base(fh.Filename)
+	mimeType, err := documents.DetectType(filename, data)
+	if err != nil {
+		return c.String(http.StatusUnsupportedMediaType, err.Error())
+	}
+	text, err := documents.Extract(mimeType, data)
+	if errors.Is(err, documents.ErrNoText) {
+		return c.String(http.StatusUnprocessableEntity, err.Error())
+	}
+	if err != nil {
+		log.Printf("extract %s for tree %d: %v", filename, tree.ID, err)
+		return c.String(http.StatusUnprocessableEntity, "Failed to read the document")
+	}
+
+	doc := &models.Document{
+		MessageTreeID: tree.ID,
+		Filename:      filename,
+		MimeType:      mimeType,
+		SizeBytes:     len(data),
+	}
+	if err := h.retriever.Add(c.Request().Context(), doc, text); err != nil {
+		log.Printf("index %s for tree %d: %v", filename, tree.ID, err)
+		return c.String(http.StatusInternalServerError, "Failed to index the document")
+	}
+
+	return h.renderDocuments(c, tree.ID)
+}
+
+func (h *DocumentHandler) DeleteDocument(c echo.Context) error {
+	tree, ok := ownedTree(c, h.chatService)
+	if !ok {
+		return nil
+	}
+
+	documentID, err := strconv.Atoi(c.Param("document_id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid document ID")
+	}
+	if err := h.documentService.DeleteDocument(documentID, tree.ID); err != nil {
+		return c.String(http.StatusNotFound, "Document not found")
+	}
+
+	return h.renderDocuments(c, tree.ID)
+}
+
+func (h *DocumentHandler) renderDocuments(c echo.Context, treeID int) error {
+	docs, err := h.documentService.GetTreeDocuments(treeID)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to load documents")
+	}
+	return templates.DocumentPanel(treeID, docs).Render(c.Request().Context(), c.Response().Writer)
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"t3sesame/internal/export"
+	"t3sesame/internal/markdown"
+	"t3sesame/internal/models"
+	"t3sesame/internal/templates"
+
+	"github.com/labstack/echo/v4"
+)
+
+const stylesheetPath = "static/css/styles.css"
+
+var unsafeFilename = regexp.MustCompile(`[^a-zA-Z0-9-_]+`)
+
+// ExportChat downloads a tree as Markdown, JSON or a self-contained HTML
+// page. JSON carries every branch, the other formats the active one.
+func (h *ChatHandler) ExportChat(c echo.Context) error {
+	tree, ok := ownedTree(c, h.chatService)
+	if !ok {
+		return nil
+	}
+
+	messages, err := h.chatService.GetMessagesByTreeID(tree.ID)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to load messages")
+	}
+
+	format := c.QueryParam("format")
+	var buf bytes.Buffer
+	var contentType string
+	switch format {
+	case "md":
+		contentType = "text/markdown; charset=utf-8"
+		err = export.WriteMarkdown(&buf, tree, export.ActivePath(tree, messages))
+	case "json":
+		contentType = echo.MIMEApplicationJSONCharsetUTF8
+		err = export.WriteJSON(&buf, export.NewDocument(tree, messages, h.modelRefs(tree, messages)))
+	case "html":
+		contentType = echo.MIMETextHTMLCharsetUTF8
+		err = h.writeHTMLExport(c, &buf, tree, export.ActivePath(tree, messages))
+	default:
+		return c.String(http.StatusBadRequest, "Format must be md, json or html")
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to export conversation")
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition,
+		fmt.Sprintf(`attachment; filename="%s.%s"`, exportFilename(tree.Title), format))
+	return c.Blob(http.StatusOK, contentType, buf.Bytes())
+}
+
+// modelRefs resolves the models used in a tree to "provider/name"
+func (h *ChatHandler) modelRefs(tree *models.MessageTree, messages []models.Message) map[int]string {
+	refs := map[int]string{}
+	resolve := func(id *int) {
+		if id == nil {
+			return
+		}
+		if _, ok := refs[*id]; ok {
+			return
+		}
+		if m, err := h.modelService.GetModel(*id); err == nil {
+			refs[*id] = m.Ref()
+		}
+	}
+
+	resolve(tree.AIID)
+	for _, msg := range messages {
+		resolve(msg.ModelID)
+	}
+	return refs
+}
+
+// writeHTMLExport inlines the stylesheets and image thumbnails, so the file
+// works offline
+func (h *ChatHandler) writeHTMLExport(c echo.Context, w io.Writer, tree *models.MessageTree, path []models.Message) error {
+	var css bytes.Buffer
+	styles, err := os.ReadFile(stylesheetPath)
+	if err != nil {
+		return err
+	}
+	css.Write(styles)
+	if err := markdown.WriteCSS(&css); err != nil {
+		return err
+	}
+
+	images := map[string]string{}
+	for _, msg := range path {
+		for _, part := range msg.Parts {
+			if part.Type != models.PartImage {
+				continue
+			}
+			r, err := h.blobs.Get(c.Request().Context(), part.ThumbnailRef)
+			if err != nil {
+				// A missing thumbnail should not fail the export
+				continue
+			}
+			data, err := io.ReadAll(r)
+			r.Close()
+			if err == nil {
+				images[part.ThumbnailRef] = "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(data)
+			}
+		}
+	}
+
+	return templates.ExportPage(*tree, path, css.String(), images).Render(c.Request().Context(), w)
+}
+
+func exportFilename(title string) string {
+	name := strings.ToLower(unsafeFilename.ReplaceAllString(title, "-"))
+	if len(name) > 80 {
+		name = name[:80]
+	}
+	if name = strings.Trim(name, "-"); name == "" {
+		return "conversation"
+	}
+	return name
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"t3sesame/internal/importer"
+	"t3sesame/internal/markdown"
+	"t3sesame/internal/models"
+	"t3sesame/internal/storage"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+// externalRef matches anything a browser would fetch from elsewhere
+var externalRef = regexp.MustCompile(`(?i)(src|href)\s*=\s*["']?(https?:)?//|<link\b|<script\b[^>]*\bsrc|url\(\s*["']?(https?:)?//|@import`)
+
+// Every format follows the active branch, except JSON which keeps all of
+// them and imports back to the same tree
+func TestExportChat(t *testing.T) {
+	db := testDB(t)
+	h := newTestChatHandler(t, db, "fake/echo")
+	user := testUser(t, db)
+
+	tree, err := h.chatService.CreateMessageTree(user.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumbnail := storage.NewKey("jpg")
+	if err := h.blobs.Put(context.Background(), thumbnail, strings.NewReader("thumbnail bytes")); err != nil {
+		t.Fatal(err)
+	}
+	save := func(parent *int, role string, parts models.Parts) *models.Message {
+		msg := &models.Message{MessageTreeID: tree.ID, ParentMessageID: parent, Role: role, Parts: parts}
+		if err := h.chatService.SaveMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+	question := save(nil, models.RoleUser, models.Parts{
+		{Type: models.PartText, Text: "Question"},
+		{Type: models.PartImage, ImageRef: storage.NewKey("png"), ThumbnailRef: thumbnail, MimeType: "image/png"},
+	})
+	first := save(&question.ID, models.RoleAssistant, models.Parts{{Type: models.PartText, Text: "First answer"}})
+	save(&first.ID, models.RoleUser, models.Parts{{Type: models.PartText, Text: "Follow-up on the first"}})
+	second := save(&question.ID, models.RoleAssistant, models.Parts{{Type: models.PartText, Text: "Second answer\n\n```go\nfunc main() {}\n```"}})
+
+	// The HTML export reads the stylesheet relative to the repository root
+	t.Chdir("../..")
+
+	e := echo.New()
+	e.Use(session.Middleware(sessions.NewCookieStore([]byte("test"))))
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			sess, _ := session.Get("session", c)
+			sess.Values["user_id"] = user.ID
+			return next(c)
+		}
+	})
+	e.GET("/chat/:tree_id/export", h.ExportChat)
+	exportAs := func(format string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/chat/"+strconv.Itoa(tree.ID)+"/export?format="+format, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		expectStatus(t, rec, http.StatusOK)
+		return rec.Body.String()
+	}
+
+	for _, format := range []string{"md", "html"} {
+		body := exportAs(format)
+		for _, want := range []string{"Question", "Second answer"} {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s export lacks %q", format, want)
+			}
+		}
+		for _, other := range []string{"First answer", "Follow-up"} {
+			if strings.Contains(body, other) {
+				t.Errorf("%s export contains %q from another branch", format, other)
+			}
+		}
+	}
+
+	// The HTML page needs nothing from the network or the server
+	page := exportAs("html")
+	if ref := externalRef.FindString(page); ref != "" {
+		t.Errorf("HTML export refers to %q", ref)
+	}
+	var chroma bytes.Buffer
+	markdown.WriteCSS(&chroma)
+	styles := strings.SplitN(strings.TrimSpace(chroma.String()), "\n", 2)[0]
+	if !strings.Contains(page, "<style>") || !strings.Contains(page, ".markdown") || !strings.Contains(page, styles) {
+		t.Error("HTML export lacks the inlined stylesheet or highlighting styles")
+	}
+	if !strings.Contains(page, "data:image/jpeg;base64,"+base64.StdEncoding.EncodeToString([]byte("thumbnail bytes"))) {
+		t.Error("HTML export lacks the inlined thumbnail")
+	}
+	if strings.Contains(page, thumbnail) {
+		t.Error("HTML export refers to the thumbnail by key")
+	}
+
+	_, convs, err := importer.Parse([]byte(exportAs("json")))
+	if err != nil || len(convs) != 1 || convs[0].Err != nil {
+		t.Fatalf("Parse = %+v, %v", convs, err)
+	}
+	conv := convs[0]
+	if len(conv.Messages) != 4 || conv.Branches() != 2 {
+		t.Errorf("got %d messages on %d branches, want 4 on 2", len(conv.Messages), conv.Branches())
+	}
+	if conv.ActiveLeafID == nil || *conv.ActiveLeafID != second.ID {
+		t.Errorf("ActiveLeafID = %v, want %d", conv.ActiveLeafID, second.ID)
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"t3sesame/internal/importer"
+	"t3sesame/internal/models"
+	"t3sesame/internal/templates"
+
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+const maxImportSize = 100 << 20
+
+type ImportHandler struct {
+	chatService  *models.ChatService
+	modelService *models.ModelService
+}
+
+func NewImportHandler(chatService *models.ChatService, modelService *models.ModelService) *ImportHandler {
+	return &ImportHandler{chatService: chatService, modelService: modelService}
+}
+
+func (h *ImportHandler) ShowImport(c echo.Context) error {
+	return templates.ImportPage().Render(c.Request().Context(), c.Response().Writer)
+}
+
+// Import reads a ChatGPT, Claude or T3Sesame export. With dry_run nothing
+// is stored and the report previews what would be imported. Every
+// conversation is stored on its own, so one failure does not undo the rest.
+func (h *ImportHandler) Import(c echo.Context) error {
+	sess, _ := session.Get("session", c)
+	userID := sess.Values["user_id"].(int)
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return c.String(http.StatusBadRequest, "No file uploaded")
+	}
+	if fh.Size > maxImportSize {
+		return c.String(http.StatusRequestEntityTooLarge, "Exports can be at most 100 MB")
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Failed to read file")
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxImportSize))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Failed to read file")
+	}
+
+	source, convs, err := importer.Parse(data)
+	if err != nil {
+		return c.String(http.StatusUnprocessableEntity, "Could not read the export: "+err.Error())
+	}
+
+	dryRun := c.FormValue("dry_run") == "true"
+	modelIDs := map[string]*int{}
+	results := make([]importer.Result, 0, len(convs))
+	for _, conv := range convs {
+		result := importer.Result{
+			Title:    conv.Title,
+			Messages: len(conv.Messages),
+			Branches: conv.Branches(),
+		}
+		switch {
+		case conv.Err != nil:
+			result.Error = conv.Err.Error()
+		case !dryRun:
+			tree, err := h.store(userID, conv, modelIDs)
+			if err != nil {
+				log.Printf("import %q for user %d: %v", conv.Title, userID, err)
+				result.Error = "Failed to save conversation"
+			} else {
+				result.TreeID = tree.ID
+			}
+		}
+		results = append(results, result)
+	}
+
+	if !dryRun {
+		c.Response().Header().Set("HX-Trigger", "refreshSidebar")
+	}
+	return templates.ImportReport(source, dryRun, results).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// store saves one conversation. Models are only linked when the export
+// names one that is in our catalog.
+func (h *ImportHandler) store(userID int, conv importer.Conversation, modelIDs map[string]*int) (*models.MessageTree, error) {
+	modelID := func(ref string) *int {
+		if ref == "" {
+			return nil
+		}
+		if id, ok := modelIDs[ref]; ok {
+			return id
+		}
+		var id *int
+		if provider, name, ok := strings.Cut(ref, "/"); ok {
+			if m, err := h.modelService.GetModelByRef(provider, name); err == nil {
+				id = &m.ID
+			}
+		}
+		modelIDs[ref] = id
+		return id
+	}
+
+	messages := make([]models.Message, 0, len(conv.Messages))
+	for _, m := range conv.Messages {
+		messages = append(messages, models.Message{
+			ID:              m.ID,
+			ParentMessageID: m.ParentID,
+			Role:            m.Role,
+			Parts:           m.Parts,
+			ModelID:         modelID(m.ModelRef),
+			Generation:      m.Generation,
+			CreatedAt:       m.CreatedAt,
+		})
+	}
+
+	source := models.MessageTree{
+		AIID:         modelID(conv.ModelRef),
+		Title:        conv.Title,
+		ActiveLeafID: conv.ActiveLeafID,
+		CreatedAt:    conv.CreatedAt,
+		UpdatedAt:    conv.UpdatedAt,
+	}
+	return h.chatService.ImportTree(userID, source, messages)
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var pathParam = regexp.MustCompile(`:(\w+)`)
+
+// openAPIDocument describes the API routes. Request and response schemas
+// are derived from the Go types the handlers bind and return, by their
+// json tags.
+func openAPIDocument(routes []apiRoute) map[string]any {
+	schemas := map[string]any{}
+	errorRef := schemaFor(reflect.TypeOf(apiError{}), schemas)
+
+	paths := map[string]map[string]any{}
+	for _, r := range routes {
+		path := pathParam.ReplaceAllString(r.path, "{$1}")
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+
+		var params []any
+		for _, m := range pathParam.FindAllStringSubmatch(r.path, -1) {
+			params = append(params, map[string]any{
+				"name": m[1], "in": "path", "required": true,
+				"schema": map[string]any{"type": "integer"},
+			})
+		}
+		for _, q := range r.query {
+			params = append(params, map[string]any{
+				"name": q.name, "in": "query", "description": q.description,
+				"schema": map[string]any{"type": q.typ},
+			})
+		}
+
+		success := map[string]any{"description": http.StatusText(r.status)}
+		if r.response != nil {
+			content := map[string]any{
+				"application/json": map[string]any{"schema": schemaFor(reflect.TypeOf(r.response), schemas)},
+			}
+			if r.stream {
+				content["text/event-stream"] = map[string]any{"schema": map[string]any{"type": "string"}}
+			}
+			success["content"] = content
+		}
+
+		op := map[string]any{
+			"operationId": r.id,
+			"summary":     r.summary,
+			"responses": map[string]any{
+				strconv.Itoa(r.status): success,
+				"default": map[string]any{
+					"description": "Error",
+					"content":     map[string]any{"application/json": map[string]any{"schema": errorRef}},
+				},
+			},
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if r.request != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": schemaFor(reflect.TypeOf(r.request), schemas)},
+				},
+			}
+		}
+		if r.public {
+			op["security"] = []any{}
+		}
+		paths[path][strings.ToLower(r.method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "T3Sesame API",
+			"version": "1",
+		},
+		"servers":  []any{map[string]any{"url": "/api/v1"}},
+		"security": []any{map[string]any{"bearerAuth": []any{}}},
+		"paths":    paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor returns the schema of t. Named structs are added to schemas
+// and referenced.
+func schemaFor(t reflect.Type, schemas map[string]any) map[string]any {
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := schemaFor(t.Elem(), schemas)
+		if _, ok := s["$ref"]; ok {
+			return map[string]any{"allOf": []any{s}, "nullable": true}
+		}
+		s["nullable"] = true
+		return s
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": schemaFor(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaFor(t.Elem(), schemas)}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Struct:
+		name := schemaName(t)
+		ref := map[string]any{"$ref": "#/components/schemas/" + name}
+		if _, ok := schemas[name]; ok {
+			return ref
+		}
+		// Placeholder first, in case the struct refers to itself
+		schemas[name] = nil
+
+		properties := map[string]any{}
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if !f.IsExported() || tag == "-" {
+				continue
+			}
+			field, opts, _ := strings.Cut(tag, ",")
+			if field == "" {
+				field = f.Name
+			}
+			properties[field] = schemaFor(f.Type, schemas)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, field)
+			}
+		}
+		schema := map[string]any{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		schemas[name] = schema
+		return ref
+	}
+	return map[string]any{}
+}
+
+// schemaName turns apiTree into Tree and models.ContentPart into ContentPart
+func schemaName(t reflect.Type) string {
+	name := strings.TrimPrefix(t.Name(), "api")
+	if name == "" {
+		return t.Name()
+	}
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"t3sesame/internal/llm"
+	"t3sesame/internal/models"
+	"t3sesame/internal/templates"
+
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+const semanticSearchLimit = 20
+
+type SearchHandler struct {
+	chatService      *models.ChatService
+	embeddingService *models.EmbeddingService
+	embedder         llm.Embedder
+}
+
+func NewSearchHandler(chatService *models.ChatService, embeddingService *models.EmbeddingService, embedder llm.Embedder) *SearchHandler {
+	return &SearchHandler{
+		chatService:      chatService,
+		embeddingService: embeddingService,
+		embedder:         embedder,
+	}
+}
+
+// Search renders the sidebar hits for the search box. With mode=semantic
+// messages are ranked by embedding similarity instead of matching words.
+func (h *SearchHandler) Search(c echo.Context) error {
+	sess, _ := session.Get("session", c)
+	userID := sess.Values["user_id"].(int)
+
+	query := strings.TrimSpace(c.QueryParam("q"))
+	var results []models.SearchResult
+	var err error
+	if c.QueryParam("mode") == "semantic" {
+		results, err = h.semanticSearch(c, userID, query)
+	} else {
+		results, err = h.chatService.Search(userID, query)
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Search failed")
+	}
+
+	return templates.SearchResults(query, results).Render(c.Request().Context(), c.Response().Writer)
+}
+
+func (h *SearchHandler) semanticSearch(c echo.Context, userID int, query string) ([]models.SearchResult, error) {
+	if query == "" {
+		return nil, nil
+	}
+
+	vectors, err := h.embedder.Embed(c.Request().Context(), []string{query})
+	if err != nil {
+		return nil, err
+	}
+
+	return h.embeddingService.SimilarMessages(userID, h.embedder.Name(), vectors[0], semanticSearchLimit)
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"t3sesame/internal/models"
+	"t3sesame/internal/storage"
+	"t3sesame/internal/templates"
+	"time"
+
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+// shareExpiries are the lifetimes offered for share links, "" meaning never
+var shareExpiries = map[string]time.Duration{
+	"":     0,
+	"24h":  24 * time.Hour,
+	"168h": 7 * 24 * time.Hour,
+	"720h": 30 * 24 * time.Hour,
+}
+
+type ShareHandler struct {
+	chatService  *models.ChatService
+	shareService *models.ShareService
+	blobs        storage.BlobStore
+}
+
+func NewShareHandler(chatService *models.ChatService, shareService *models.ShareService, blobs storage.BlobStore) *ShareHandler {
+	return &ShareHandler{
+		chatService:  chatService,
+		shareService: shareService,
+		blobs:        blobs,
+	}
+}
+
+// ListShares renders the share links panel of a chat
+func (h *ShareHandler) ListShares(c echo.Context) error {
+	tree, ok := ownedTree(c, h.chatService)
+	if !ok {
+		return nil
+	}
+	return h.renderShares(c, tree.ID)
+}
+
+// CreateShare mints a link to the active branch. mode=live shares the tree
+// as it changes, anything else a snapshot of the branch as it is now.
+func (h *ShareHandler) CreateShare(c echo.Context) error {
+	tree, ok := ownedTree(c, h.chatService)
+	if !ok {
+		return nil
+	}
+
+	lifetime, ok := shareExpiries[c.FormValue("expires")]
+	if !ok {
+		return c.String(http.StatusBadRequest, "Invalid expiry")
+	}
+	var expiresAt *time.Time
+	if lifetime > 0 {
+		t := time.Now().Add(lifetime)
+		expiresAt = &t
+	}
+
+	path, err := h.chatService.GetActivePath(tree.ID)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to load messages")
+	}
+	if len(path) == 0 {
+		return c.String(http.StatusBadRequest, "There is nothing to share yet")
+	}
+
+	var snapshot *models.ShareSnapshot
+	if c.FormValue("mode") != "live" {
+		snapshot = &models.ShareSnapshot{Title: tree.Title, Messages: path}
+	}
+	if _, err := h.shareService.CreateShare(tree.ID, snapshot, expiresAt); err != nil {
+		log.Printf("create share for tree %d: %v", tree.ID, err)
+		return c.String(http.StatusInternalServerError, "Failed to create share link")
+	}
+
+	return h.renderShares(c, tree.ID)
+}
+
+func (h *ShareHandler) RevokeShare(c echo.Context) error {
+	tree, ok := ownedTree(c, h.chatService)
+	if !ok {
+		return nil
+	}
+
+	shareID, err := strconv.Atoi(c.Param("share_id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid share ID")
+	}
+	if err := h.shareService.RevokeShare(shareID, tree.ID); err != nil {
+		return c.String(http.StatusNotFound, "Share link not found")
+	}
+
+	return h.renderShares(c, tree.ID)
+}
+
+func (h *ShareHandler) renderShares(c echo.Context, treeID int) error {
+	shares, err := h.shareService.GetTreeShares(treeID)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to load share links")
+	}
+	return templates.SharePanel(treeID, shares).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// ShowShare is the public read-only page of a share link. It is served
+// without requiring a login, so it only shows the shared branch and the owner's
+// display name.
+func (h *ShareHandler) ShowShare(c echo.Context) error {
+	share, title, messages, ok := h.sharedConversation(c)
+	if !ok {
+		return nil
+	}
+	sess, _ := session.Get("session", c)
+	_, loggedIn := sess.Values["user_id"].(int)
+
+	// Revoking must take effect at once, and the token must not leak to
+	// sites linked from the conversation
+	header := c.Response().Header()
+	header.Set(echo.HeaderCacheControl, "no-store")
+	header.Set("Referrer-Policy", "no-referrer")
+	header.Set("X-Robots-Tag", "noindex")
+
+	return templates.SharePage(*share, title, messages, loggedIn).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// ForkShare copies what a share link shows into the viewer's account, so
+// they can continue the conversation there
+func (h *ShareHandler) ForkShare(c echo.Context) error {
+	sess, _ := session.Get("session", c)
+	userID := sess.Values["user_id"].(int)
+
+	share, title, messages, ok := h.sharedConversation(c)
+	if !ok {
+		return nil
+	}
+
+	tree, err := h.chatService.ForkTree(userID, share.MessageTreeID, title, messages)
+	if err != nil {
+		log.Printf("fork share %d for user %d: %v", share.ID, userID, err)
+		return c.String(http.StatusInternalServerError, "Failed to copy the conversation")
+	}
+
+	return c.Redirect(http.StatusSeeOther, "/?chat="+strconv.Itoa(tree.ID))
+}
+
+// ServeSharedImage returns an image or thumbnail that is part of the shared
+// branch
+func (h *ShareHandler) ServeSharedImage(c echo.Context) error {
+	_, _, messages, ok := h.sharedConversation(c)
+	if !ok {
+		return nil
+	}
+
+	key := c.Param("key")
+	if !storage.ValidKey(key) || !hasBlob(messages, key) {
+		return c.String(http.StatusNotFound, "Image not found")
+	}
+
+	r, err := h.blobs.Get(c.Request().Context(), key)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Image not found")
+	}
+	defer r.Close()
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	c.Response().Header().Set("X-Content-Type-Options", "nosniff")
+	return c.Stream(http.StatusOK, imageContentType(key), r)
+}
+
+// sharedConversation resolves the token in the route to the title and
+// messages it shows. When it reports false the error response has been
+// written.
+func (h *ShareHandler) sharedConversation(c echo.Context) (*models.Share, string, []models.Message, bool) {
+	share, err := h.shareService.GetShare(c.Param("token"))
+	if err != nil {
+		c.String(http.StatusNotFound, "This link does not exist or has expired")
+		return nil, "", nil, false
+	}
+	if !share.Live() {
+		return share, share.Snapshot.Title, share.Snapshot.Messages, true
+	}
+
+	tree, err := h.chatService.GetMessageTree(share.MessageTreeID, share.OwnerID)
+	if err != nil {
+		c.String(http.StatusNotFound, "This link does not exist or has expired")
+		return nil, "", nil, false
+	}
+	messages, err := h.chatService.GetActivePath(tree.ID)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Failed to load messages")
+		return nil, "", nil, false
+	}
+	return share, tree.Title, messages, true
+}
+
+func hasBlob(messages []models.Message, key string) bool {
+	for _, msg := range messages {
+		for _, part := range msg.Parts {
+			if part.Type == models.PartImage && (part.ImageRef == key || part.ThumbnailRef == key) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"t3sesame/internal/documents"
+	"t3sesame/internal/llm"
+	"t3sesame/internal/markdown"
+	"t3sesame/internal/models"
+	"t3sesame/internal/templates"
+	"time"
+
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+// StreamReply generates the assistant answer to a user message and pushes it
+// to the browser as Server-Sent Events. The reply is persisted when the model
+// finishes or, with whatever arrived so far, when the stream is cut off.
+func (h *ChatHandler) StreamReply(c echo.Context) error {
+	sess, _ := session.Get("session", c)
+	userID := sess.Values["user_id"].(int)
+
+	treeID, err := strconv.Atoi(c.Param("tree_id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid tree ID")
+	}
+	messageID, err := strconv.Atoi(c.Param("message_id"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid message ID")
+	}
+
+	// Verify ownership
+	tree, err := h.chatService.GetMessageTree(treeID, userID)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Conversation not found")
+	}
+
+	msg, err := h.chatService.GetMessage(messageID, treeID)
+	if err != nil || !msg.IsFromUser() {
+		return c.String(http.StatusNotFound, "Message not found")
+	}
+
+	run, err := h.startReply(c.Request().Context(), tree, msg)
+	switch {
+	case errors.Is(err, errAnswered):
+		return c.String(http.StatusConflict, "Message already answered")
+	case errors.Is(err, errStreaming):
+		return c.String(http.StatusConflict, "Reply is already streaming")
+	case err != nil:
+		return c.String(http.StatusInternalServerError, "No AI model configured")
+	}
+	defer run.finish()
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set(echo.HeaderCacheControl, "no-cache")
+	w.Header().Set(echo.HeaderConnection, "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	w.Flush()
+
+	// Always the last event; the page closes the connection on it instead of
+	// letting EventSource reconnect once the stream ends
+	defer func() {
+		writeSSE(w, "close", "")
+		w.Flush()
+	}()
+
+	// The reply so far is re-rendered as a whole, since a delta can change
+	// the meaning of earlier Markdown. Throttling keeps this cheap; whatever
+	// arrives after the last render is shown by the final bubble.
+	var lastRender time.Time
+	aiMsg, err := run.generate(c.Request().Context(), func(content, delta string) error {
+		if time.Since(lastRender) < renderInterval {
+			return nil
+		}
+		lastRender = time.Now()
+		if err := writeSSE(w, "render", markdown.Render(content)); err != nil {
+			return err
+		}
+		w.Flush()
+		return nil
+	})
+	if err != nil {
+		writeSSE(w, "done", errorBubble(replyErrorMessage(err)))
+		w.Flush()
+		return nil
+	}
+
+	// A regenerated reply needs its sibling pager right away
+	if siblings, err := h.chatService.GetSiblings(aiMsg); err == nil {
+		aiMsg.SiblingIndex = len(siblings)
+		aiMsg.SiblingCount = len(siblings)
+	}
+
+	var buf bytes.Buffer
+	templates.MessageBubble(*aiMsg).Render(context.Background(), &buf)
+	writeSSE(w, "done", buf.String())
+	w.Flush()
+
+	if run.titles == nil {
+		return nil
+	}
+	select {
+	case title, ok := <-run.titles:
+		if ok {
+			tree.Title = title
+			buf.Reset()
+			templates.TitleUpdate(*tree).Render(context.Background(), &buf)
+			writeSSE(w, "title", buf.String())
+			w.Flush()
+		}
+	case <-c.Request().Context().Done():
+	}
+
+	return nil
+}
+
+var (
+	errAnswered  = errors.New("message already answered")
+	errStreaming = errors.New("reply is already streaming")
+	errNoReply   = errors.New("no reply generated")
+	errSaveReply = errors.New("save reply")
+)
+
+// replyRun answers the user message at the end of a tree's active branch.
+// It is shared by the HTML stream and the API.
+type replyRun struct {
+	h        *ChatHandler
+	tree     *models.MessageTree
+	msg      *models.Message
+	history  []models.Message
+	provider llm.Provider
+	req      llm.Request
+	model    *models.Model
+	chunks   []models.DocumentChunk
+
+	// Receives the generated title after the first exchange, nil otherwise
+	titles <-chan string
+}
+
+// startReply checks that msg is waiting for a reply and claims it, so two
+// streams never answer it twice. Call finish when done.
+func (h *ChatHandler) startReply(ctx context.Context, tree *models.MessageTree, msg *models.Message) (*replyRun, error) {
+	// Only a user message at the end of the active branch is waiting for a
+	// reply. Saving the reply moves the leaf on, which also stops
+	// EventSource reconnects from generating twice.
+	history, err := h.chatService.GetActivePath(tree.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 || history[len(history)-1].ID != msg.ID {
+		return nil, errAnswered
+	}
+
+	provider, req, model, err := h.buildRequest(ctx, tree, history)
+	if err != nil {
+		log.Printf("build request for tree %d: %v", tree.ID, err)
+		return nil, err
+	}
+	if !h.beginStream(msg.ID) {
+		return nil, errStreaming
+	}
+
+	// Attached documents are searched for the question first. Without them
+	// the model still answers, just without sources.
+	chunks, err := h.retriever.Retrieve(ctx, tree.ID, msg.Content)
+	if err != nil {
+		log.Printf("retrieve documents for tree %d: %v", tree.ID, err)
+	}
+	if len(chunks) > 0 {
+		req.System = documents.SourcesPrompt(chunks)
+	}
+
+	return &replyRun{
+		h:        h,
+		tree:     tree,
+		msg:      msg,
+		history:  history,
+		provider: provider,
+		req:      req,
+		model:    model,
+		chunks:   chunks,
+	}, nil
+}
+
+func (r *replyRun) finish() {
+	r.h.endStream(r.msg.ID)
+}
+
+// generate streams the reply, calling onDelta with the text so far and the
+// newest delta, and saves it. An error means nothing was saved; it wraps
+// errNoReply or errSaveReply, and replyErrorMessage words it for the user.
+func (r *replyRun) generate(ctx context.Context, onDelta func(content, delta string) error) (*models.Message, error) {
+	var content strings.Builder
+	var firstToken time.Duration
+	start := time.Now()
+	resp, genErr := r.provider.Stream(ctx, r.req, func(delta string) error {
+		if content.Len() == 0 {
+			firstToken = time.Since(start)
+		}
+		content.WriteString(delta)
+		return onDelta(content.String(), delta)
+	})
+
+	reply := content.String()
+	if genErr == nil {
+		reply = resp.Content
+	} else {
+		log.Printf("%s stream for message %d: %v", r.provider.Name(), r.msg.ID, genErr)
+	}
+	generation := replyGeneration(resp, genErr, firstToken, time.Since(start))
+	parts := replyParts(resp, reply)
+	if len(parts) == 0 {
+		if genErr != nil {
+			return nil, fmt.Errorf("%w: %w", errNoReply, genErr)
+		}
+		return nil, errNoReply
+	}
+
+	parts = append(parts, documents.Citations(r.chunks, reply)...)
+
+	// Persist even when the client went away mid-stream
+	aiMsg := &models.Message{
+		MessageTreeID:   r.tree.ID,
+		ParentMessageID: &r.msg.ID,
+		Role:            models.RoleAssistant,
+		Parts:           parts,
+		ModelID:         &r.model.ID,
+		ModelName:       r.model.DisplayName,
+		Generation:      generation,
+	}
+	if err := r.h.chatService.SaveMessage(aiMsg); err != nil {
+		log.Printf("save reply for message %d: %v", r.msg.ID, err)
+		return nil, errSaveReply
+	}
+
+	// The first exchange names the conversation
+	if len(r.history) == 1 && r.tree.Title == models.DefaultTitle {
+		r.titles = r.h.generateTitle(r.tree, r.msg.Content, aiMsg.Content)
+	}
+
+	return aiMsg, nil
+}
+
+const renderInterval = 100 * time.Millisecond
+
+// replyGeneration collects the metadata stored with a reply. resp is nil
+// when the stream failed or the client went away.
+func replyGeneration(resp *llm.Response, genErr error, firstToken, total time.Duration) models.Generation {
+	g := models.Generation{
+		TimeToFirstTokenMs: int(firstToken.Milliseconds()),
+		DurationMs:         int(total.Milliseconds()),
+	}
+	switch {
+	case resp != nil:
+		g.PromptTokens = resp.Usage.PromptTokens
+		g.CompletionTokens = resp.Usage.CompletionTokens
+		g.FinishReason = resp.FinishReason
+		g.ProviderRequestID = resp.RequestID
+	case errors.Is(genErr, context.Canceled):
+		g.FinishReason = llm.FinishInterrupted
+	default:
+		g.FinishReason = llm.FinishError
+	}
+	return g
+}
+
+func (h *ChatHandler) beginStream(messageID int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.streaming[messageID] {
+		return false
+	}
+	h.streaming[messageID] = true
+	return true
+}
+
+func (h *ChatHandler) endStream(messageID int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.streaming, messageID)
+}
+
+// writeSSE writes one event. Multi-line payloads need a data field per line.
+func writeSSE(w io.Writer, event, data string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "event: %s\n", event)
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// replyErrorMessage is the text shown when generate fails
+func replyErrorMessage(err error) string {
+	var blocked *llm.BlockedError
+	switch {
+	case errors.Is(err, errSaveReply):
+		return "Failed to save AI response"
+	case errors.As(err, &blocked):
+		return blocked.Error()
+	}
+	return "The AI provider failed to respond"
+}
+
+func errorBubble(message string) string {
+	return `<div class="text-sm text-red-600">` + html.EscapeString(message) + `</div>`
+}
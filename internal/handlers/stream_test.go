@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+type sseEvent struct {
+	name string
+	data string
+}
+
+func readEvents(t *testing.T, body string) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var ev sseEvent
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if ev.name != "" {
+				events = append(events, ev)
+			}
+			ev = sseEvent{}
+		case strings.HasPrefix(line, "event: "):
+			ev.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if ev.data != "" {
+				ev.data += "\n"
+			}
+			ev.data += strings.TrimPrefix(line, "data: ")
+		}
+	}
+	return events
+}
+
+// The fake provider answers through the registry and the shared reply path,
+// which streams its deltas and saves the reply at the end of the branch
+func TestReplyStreamsFakeProvider(t *testing.T) {
+	db := testDB(t)
+	h := newTestChatHandler(t, db, "fake/echo")
+	_, request := testAPI(t, db, h)
+
+	// A title keeps the first exchange from naming the tree in the background
+	rec := request(http.MethodPost, "/trees", `{"title": "Fake provider"}`)
+	expectStatus(t, rec, http.StatusCreated)
+	var tree apiTree
+	json.Unmarshal(rec.Body.Bytes(), &tree)
+	treePath := "/trees/" + strconv.Itoa(tree.ID)
+
+	rec = request(http.MethodPost, treePath+"/messages", `{"content": "Hello there"}`)
+	expectStatus(t, rec, http.StatusCreated)
+	var question apiMessage
+	json.Unmarshal(rec.Body.Bytes(), &question)
+
+	rec = request(http.MethodPost, treePath+"/messages/"+strconv.Itoa(question.ID)+"/reply", "",
+		echo.HeaderAccept, "text/event-stream")
+	expectStatus(t, rec, http.StatusOK)
+
+	want := `You said: "Hello there" (turn 1)`
+	var streamed strings.Builder
+	var deltas int
+	var reply apiMessage
+	for _, ev := range readEvents(t, rec.Body.String()) {
+		switch ev.name {
+		case "delta":
+			var delta struct{ Content string }
+			if err := json.Unmarshal([]byte(ev.data), &delta); err != nil {
+				t.Fatalf("delta %q: %v", ev.data, err)
+			}
+			streamed.WriteString(delta.Content)
+			deltas++
+		case "done":
+			if err := json.Unmarshal([]byte(ev.data), &reply); err != nil {
+				t.Fatalf("done %q: %v", ev.data, err)
+			}
+		default:
+			t.Fatalf("unexpected %s event: %s", ev.name, ev.data)
+		}
+	}
+	if deltas < 2 || streamed.String() != want {
+		t.Errorf("streamed %d deltas %q, want %q", deltas, streamed.String(), want)
+	}
+
+	// The saved reply answers the question and ends the active branch
+	if reply.ID == 0 || reply.Role != "assistant" || reply.Content != want {
+		t.Fatalf("reply = %+v", reply)
+	}
+	if reply.ParentID == nil || *reply.ParentID != question.ID {
+		t.Errorf("reply parent = %v, want %d", reply.ParentID, question.ID)
+	}
+	if reply.Generation == nil || reply.Generation.FinishReason != "stop" || reply.Generation.CompletionTokens != deltas {
+		t.Errorf("generation = %+v", reply.Generation)
+	}
+
+	rec = request(http.MethodGet, treePath, "")
+	expectStatus(t, rec, http.StatusOK)
+	json.Unmarshal(rec.Body.Bytes(), &tree)
+	if tree.ActiveLeafID == nil || *tree.ActiveLeafID != reply.ID {
+		t.Errorf("active leaf = %v, want %d", tree.ActiveLeafID, reply.ID)
+	}
+
+	rec = request(http.MethodGet, treePath+"/messages", "")
+	expectStatus(t, rec, http.StatusOK)
+	var page apiMessagePage
+	json.Unmarshal(rec.Body.Bytes(), &page)
+	if len(page.Data) != 2 || page.Data[1].ID != reply.ID || page.Data[1].Content != want {
+		t.Errorf("messages = %+v", page.Data)
+	}
+
+	// Answered messages are not answered again
+	rec = request(http.MethodPost, treePath+"/messages/"+strconv.Itoa(question.ID)+"/reply", "")
+	expectStatus(t, rec, http.StatusConflict)
+}
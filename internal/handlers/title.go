@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"strings"
+	"t3sesame/internal/llm"
+	"t3sesame/internal/models"
+	"time"
+)
+
+const (
+	titleTimeout   = 30 * time.Second
+	titleMaxLength = 60
+	titlePrompt    = "Write a short title of at most six words for the conversation below. " +
+		"Reply with the title only, no quotes and no trailing punctuation."
+)
+
+// generateTitle names a tree from its first exchange in the background. The
+// title is saved even if nobody is listening any more; the channel receives
+// it once stored and is closed either way.
+func (h *ChatHandler) generateTitle(tree *models.MessageTree, question, answer string) <-chan string {
+	titles := make(chan string, 1)
+
+	go func() {
+		defer close(titles)
+
+		ctx, cancel := context.WithTimeout(context.Background(), titleTimeout)
+		defer cancel()
+
+		ref := h.titleModel
+		if ref == "" {
+			model, err := h.treeModel(ctx, tree)
+			if err != nil {
+				log.Printf("title model for tree %d: %v", tree.ID, err)
+				return
+			}
+			ref = model.Ref()
+		}
+		provider, name, err := h.providers.Resolve(ref)
+		if err != nil {
+			log.Printf("title model %q: %v", ref, err)
+			return
+		}
+
+		resp, err := provider.Complete(ctx, llm.Request{
+			Model:  name,
+			System: titlePrompt,
+			Messages: []llm.Message{{
+				Role:    llm.RoleUser,
+				Content: "User: " + truncate(question, 1000) + "\n\nAssistant: " + truncate(answer, 1000),
+			}},
+			MaxTokens: 30,
+		})
+		if err != nil {
+			log.Printf("%s title for tree %d: %v", provider.Name(), tree.ID, err)
+			return
+		}
+
+		title := cleanTitle(resp.Content)
+		if title == "" {
+			return
+		}
+		if err := h.chatService.UpdateTitle(tree.ID, title); err != nil {
+			log.Printf("save title for tree %d: %v", tree.ID, err)
+			return
+		}
+		titles <- title
+	}()
+
+	return titles
+}
+
+// cleanTitle strips what models like to wrap titles in
+func cleanTitle(raw string) string {
+	title := strings.TrimSpace(raw)
+	if i := strings.IndexByte(title, '\n'); i >= 0 {
+		title = title[:i]
+	}
+	title = strings.TrimPrefix(title, "Title:")
+	title = strings.Trim(title, " \"'`*#.")
+	return truncate(title, titleMaxLength)
+}
+
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return strings.TrimSpace(string(runes[:max])) + "…"
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"t3sesame/internal/models"
+	"t3sesame/internal/templates"
+
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+const maxTitleLength = 200
+
+// RenameTree takes the new title from the "title" form field
+func (h *ChatHandler) RenameTree(c echo.Context) error {
+	tree, ok := ownedTree(c, h.chatService)
+	if !ok {
+		return nil
+	}
+
+	title := truncate(strings.Join(strings.Fields(c.FormValue("title")), " "), maxTitleLength)
+	if title == "" {
+		return c.String(http.StatusBadRequest, "Title cannot be empty")
+	}
+
+	if err := h.chatService.RenameTree(tree.ID, tree.UserID, title); err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to rename conversation")
+	}
+	tree.Title = title
+
+	return templates.TitleUpdate(*tree).Render(c.Request().Context(), c.Response().Writer)
+}
+
+func (h *ChatHandler) DeleteTree(c echo.Context) error {
+	tree, ok := ownedTree(c, h.chatService)
+	if !ok {
+		return nil
+	}
+
+	orphaned, err := h.chatService.DeleteTree(tree.ID, tree.UserID)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to delete conversation")
+	}
+	h.deleteBlobs(c.Request().Context(), orphaned)
+
+	c.Response().Header().Set("HX-Trigger", "refreshSidebar")
+	return templates.WelcomeMessage().Render(c.Request().Context(), c.Response().Writer)
+}
+
+// TogglePinned pins or unpins a tree. Pinned trees stay at the top of the
+// sidebar.
+func (h *ChatHandler) TogglePinned(c echo.Context) error {
+	tree, ok := ownedTree(c, h.chatService)
+	if !ok {
+		return nil
+	}
+
+	if err := h.chatService.SetPinned(tree.ID, tree.UserID, !tree.Pinned); err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to update conversation")
+	}
+
+	c.Response().Header().Set("HX-Trigger", "refreshSidebar")
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ToggleArchived hides a tree from the sidebar, or brings it back
+func (h *ChatHandler) ToggleArchived(c echo.Context) error {
+	tree, ok := ownedTree(c, h.chatService)
+	if !ok {
+		return nil
+	}
+
+	if err := h.chatService.SetArchived(tree.ID, tree.UserID, !tree.Archived); err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to update conversation")
+	}
+
+	c.Response().Header().Set("HX-Trigger", "refreshSidebar")
+	return c.NoContent(http.StatusNoContent)
+}
+
+// DuplicateTree copies a tree with all its branches and opens the copy
+func (h *ChatHandler) DuplicateTree(c echo.Context) error {
+	tree, ok := ownedTree(c, h.chatService)
+	if !ok {
+		return nil
+	}
+
+	duplicate, err := h.chatService.DuplicateTree(tree.ID, tree.UserID)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to duplicate conversation")
+	}
+
+	c.Response().Header().Set("HX-Trigger", "refreshSidebar")
+	return h.renderChat(c, duplicate)
+}
+
+// ownedTree loads the tree named in the route, enforcing ownership. When it
+// reports false the error response has been written.
+func ownedTree(c echo.Context, chatService *models.ChatService) (*models.MessageTree, bool) {
+	sess, _ := session.Get("session", c)
+	userID := sess.Values["user_id"].(int)
+
+	treeID, err := strconv.Atoi(c.Param("tree_id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid tree ID")
+		return nil, false
+	}
+
+	tree, err := chatService.GetMessageTree(treeID, userID)
+	if err != nil {
+		c.String(http.StatusNotFound, "Conversation not found")
+		return nil, false
+	}
+
+	return tree, true
+}
@@ -0,0 +1,84 @@
+// Package images validates uploaded images and renders thumbnails.
+package images
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const ThumbnailSize = 256
+
+// MaxPixels caps the dimensions of images that are decoded. A small file can
+// declare a huge canvas, which would otherwise be allocated in full.
+const MaxPixels = 40_000_000
+
+var (
+	ErrUnsupportedType = errors.New("only PNG, JPEG, GIF and WebP images are supported")
+	ErrTooLarge        = errors.New("images can be at most 40 megapixels")
+)
+
+// Extensions of the types providers accept as image input
+var extensions = map[string]string{
+	"image/png":  "png",
+	"image/jpeg": "jpg",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// Detect sniffs the image type from the content, ignoring whatever the
+// browser claimed. It returns the MIME type and a file extension.
+func Detect(data []byte) (string, string, error) {
+	mimeType := http.DetectContentType(data)
+	ext, ok := extensions[mimeType]
+	if !ok {
+		return "", "", ErrUnsupportedType
+	}
+	return mimeType, ext, nil
+}
+
+// Thumbnail scales an image to fit within ThumbnailSize pixels and encodes
+// it as JPEG. Transparent areas become white.
+func Thumbnail(data []byte) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > ThumbnailSize || h > ThumbnailSize {
+		if w >= h {
+			w, h = ThumbnailSize, max(1, h*ThumbnailSize/w)
+		} else {
+			w, h = max(1, w*ThumbnailSize/h), ThumbnailSize
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,167 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"t3sesame/internal/models"
+)
+
+// ChatGPT's conversations.json stores each conversation as a map of nodes
+// linking to their parent and children. Nodes without a message, system
+// prompts and tool traffic are hidden in ChatGPT and are dropped here, with
+// their children moved up to the nearest kept ancestor.
+type chatGPTConversation struct {
+	Title       string                 `json:"title"`
+	CreateTime  *float64               `json:"create_time"`
+	UpdateTime  *float64               `json:"update_time"`
+	Mapping     map[string]chatGPTNode `json:"mapping"`
+	CurrentNode string                 `json:"current_node"`
+}
+
+type chatGPTNode struct {
+	ID       string          `json:"id"`
+	Message  *chatGPTMessage `json:"message"`
+	Parent   *string         `json:"parent"`
+	Children []string        `json:"children"`
+}
+
+type chatGPTMessage struct {
+	Author struct {
+		Role string `json:"role"`
+	} `json:"author"`
+	CreateTime *float64 `json:"create_time"`
+	Content    struct {
+		ContentType string            `json:"content_type"`
+		Parts       []json.RawMessage `json:"parts"`
+		Text        string            `json:"text"`
+	} `json:"content"`
+	Recipient string `json:"recipient"`
+	Metadata  struct {
+		IsVisuallyHidden bool `json:"is_visually_hidden_from_conversation"`
+	} `json:"metadata"`
+}
+
+func parseChatGPT(raw json.RawMessage) (Conversation, error) {
+	var src chatGPTConversation
+	if err := json.Unmarshal(raw, &src); err != nil {
+		return Conversation{}, err
+	}
+
+	conv := Conversation{
+		Title:     src.Title,
+		CreatedAt: unixTime(src.CreateTime),
+		UpdatedAt: unixTime(src.UpdateTime),
+	}
+	if len(src.Mapping) == 0 {
+		return conv, errors.New("conversation has no nodes")
+	}
+
+	// Number kept nodes in a stable order so IDs do not depend on map order
+	ids := make([]string, 0, len(src.Mapping))
+	for id := range src.Mapping {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	local := map[string]int{}
+	for _, id := range ids {
+		node := src.Mapping[id]
+		msg, ok := chatGPTToMessage(node.Message)
+		if !ok {
+			continue
+		}
+		msg.ID = len(local) + 1
+		if msg.CreatedAt.IsZero() {
+			msg.CreatedAt = conv.CreatedAt
+		}
+		local[id] = msg.ID
+		conv.Messages = append(conv.Messages, msg)
+	}
+
+	// keptAncestor walks up past dropped nodes; visited guards against
+	// malformed files with cycles
+	keptAncestor := func(id *string) *int {
+		visited := map[string]bool{}
+		for id != nil && !visited[*id] {
+			visited[*id] = true
+			if n, ok := local[*id]; ok {
+				return &n
+			}
+			node, ok := src.Mapping[*id]
+			if !ok {
+				return nil
+			}
+			id = node.Parent
+		}
+		return nil
+	}
+
+	for i := range conv.Messages {
+		conv.Messages[i].ParentID = nil
+	}
+	for id, n := range local {
+		conv.Messages[n-1].ParentID = keptAncestor(src.Mapping[id].Parent)
+	}
+
+	current := src.CurrentNode
+	conv.ActiveLeafID = keptAncestor(&current)
+	if conv.ActiveLeafID == nil {
+		// current_node is missing or only has dropped nodes above it
+		conv.ActiveLeafID = conv.newestLeaf()
+	}
+	return conv, nil
+}
+
+func chatGPTToMessage(m *chatGPTMessage) (Message, bool) {
+	if m == nil || m.Metadata.IsVisuallyHidden {
+		return Message{}, false
+	}
+	role := m.Author.Role
+	if role != models.RoleUser && role != models.RoleAssistant {
+		return Message{}, false
+	}
+	// Assistant messages addressed to a tool are hidden calls
+	if m.Recipient != "" && m.Recipient != "all" {
+		return Message{}, false
+	}
+
+	var texts []string
+	for _, part := range m.Content.Parts {
+		var s string
+		if err := json.Unmarshal(part, &s); err == nil {
+			if s != "" {
+				texts = append(texts, s)
+			}
+			continue
+		}
+		// Non-text parts are image or file pointers whose data is not in
+		// the export
+		texts = append(texts, attachmentPlaceholder)
+	}
+	if len(texts) == 0 && m.Content.Text != "" {
+		texts = append(texts, m.Content.Text)
+	}
+	text := strings.TrimSpace(strings.Join(texts, "\n\n"))
+	if text == "" {
+		return Message{}, false
+	}
+
+	return Message{
+		Role:      role,
+		Parts:     textParts(text),
+		CreatedAt: unixTime(m.CreateTime),
+	}, true
+}
+
+func unixTime(t *float64) time.Time {
+	if t == nil || *t <= 0 {
+		return time.Time{}
+	}
+	sec, frac := math.Modf(*t)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC()
+}
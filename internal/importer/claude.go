@@ -0,0 +1,127 @@
+package importer
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"t3sesame/internal/models"
+)
+
+// Claude exports list messages in order. Newer exports link each message
+// to its parent, which keeps edited branches; older ones are one branch.
+type claudeConversation struct {
+	UUID         string          `json:"uuid"`
+	Name         string          `json:"name"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+	ChatMessages []claudeMessage `json:"chat_messages"`
+}
+
+type claudeMessage struct {
+	UUID              string    `json:"uuid"`
+	ParentMessageUUID string    `json:"parent_message_uuid"`
+	Sender            string    `json:"sender"`
+	Text              string    `json:"text"`
+	CreatedAt         time.Time `json:"created_at"`
+	Content           []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+}
+
+func parseClaude(raw json.RawMessage) (Conversation, error) {
+	var src claudeConversation
+	if err := json.Unmarshal(raw, &src); err != nil {
+		return Conversation{}, err
+	}
+
+	conv := Conversation{
+		Title:     src.Name,
+		CreatedAt: src.CreatedAt,
+		UpdatedAt: src.UpdatedAt,
+	}
+
+	// Older exports have no parent links: each message follows the one
+	// listed before it
+	keys := make([]string, len(src.ChatMessages))
+	parents := make(map[string]string, len(src.ChatMessages))
+	for i, m := range src.ChatMessages {
+		keys[i] = m.UUID
+		if keys[i] == "" {
+			keys[i] = "#" + strconv.Itoa(i)
+		}
+		parents[keys[i]] = m.ParentMessageUUID
+		if m.ParentMessageUUID == "" && i > 0 {
+			parents[keys[i]] = keys[i-1]
+		}
+	}
+
+	local := map[string]int{}
+	var kept []string
+	var latest time.Time
+	for i, m := range src.ChatMessages {
+		role := models.RoleUser
+		if m.Sender == "assistant" {
+			role = models.RoleAssistant
+		}
+
+		text := claudeText(m)
+		if text == "" {
+			continue
+		}
+
+		msg := Message{
+			ID:        len(conv.Messages) + 1,
+			Role:      role,
+			Parts:     textParts(text),
+			CreatedAt: m.CreatedAt,
+		}
+		if msg.CreatedAt.IsZero() {
+			msg.CreatedAt = conv.CreatedAt
+		}
+		local[keys[i]] = msg.ID
+		kept = append(kept, keys[i])
+		conv.Messages = append(conv.Messages, msg)
+
+		// The latest message ends the branch Claude shows
+		if !msg.CreatedAt.Before(latest) {
+			latest = msg.CreatedAt
+			id := msg.ID
+			conv.ActiveLeafID = &id
+		}
+	}
+
+	// keptAncestor walks up past messages without text, as for ChatGPT;
+	// visited guards against malformed files with cycles
+	keptAncestor := func(key string) *int {
+		visited := map[string]bool{}
+		for key != "" && !visited[key] {
+			visited[key] = true
+			if n, ok := local[key]; ok {
+				return &n
+			}
+			key = parents[key]
+		}
+		return nil
+	}
+	for i, key := range kept {
+		conv.Messages[i].ParentID = keptAncestor(parents[key])
+	}
+
+	return conv, nil
+}
+
+func claudeText(m claudeMessage) string {
+	var texts []string
+	for _, c := range m.Content {
+		if c.Type == "text" && c.Text != "" {
+			texts = append(texts, c.Text)
+		}
+	}
+	if len(texts) == 0 {
+		return strings.TrimSpace(m.Text)
+	}
+	return strings.TrimSpace(strings.Join(texts, "\n\n"))
+}
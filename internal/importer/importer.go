@@ -0,0 +1,253 @@
+// Package importer reads conversation exports from other chat tools, and
+// our own JSON export, into trees ready to be stored.
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"t3sesame/internal/export"
+	"t3sesame/internal/models"
+)
+
+const (
+	SourceChatGPT  = "ChatGPT"
+	SourceClaude   = "Claude"
+	SourceT3Sesame = "T3Sesame"
+)
+
+const maxTitleLength = 255
+
+// attachmentPlaceholder stands in for an attachment whose data is not
+// part of the export
+const attachmentPlaceholder = "[attachment not included in export]"
+
+var ErrUnknownFormat = errors.New("not a ChatGPT, Claude or T3Sesame export")
+
+// Conversation is one parsed conversation. Message IDs are local to it and
+// only used to link parents; storing assigns real ones.
+type Conversation struct {
+	Title        string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	ActiveLeafID *int
+	ModelRef     string // "provider/name", only known for our own exports
+	Messages     []Message
+	Err          error // Set when the conversation could not be parsed
+}
+
+type Message struct {
+	ID         int
+	ParentID   *int
+	Role       string
+	Parts      models.Parts
+	ModelRef   string // "provider/name", only known for our own exports
+	Generation models.Generation
+	CreatedAt  time.Time
+}
+
+// Branches counts the leaves, i.e. how many alternative endings there are
+func (c *Conversation) Branches() int {
+	hasChildren := map[int]bool{}
+	for _, m := range c.Messages {
+		if m.ParentID != nil {
+			hasChildren[*m.ParentID] = true
+		}
+	}
+	leaves := 0
+	for _, m := range c.Messages {
+		if !hasChildren[m.ID] {
+			leaves++
+		}
+	}
+	return leaves
+}
+
+// newestLeaf returns the most recently created leaf, nil without messages
+func (c *Conversation) newestLeaf() *int {
+	hasChildren := map[int]bool{}
+	for _, m := range c.Messages {
+		if m.ParentID != nil {
+			hasChildren[*m.ParentID] = true
+		}
+	}
+	var newest *Message
+	for i, m := range c.Messages {
+		if !hasChildren[m.ID] && (newest == nil || m.CreatedAt.After(newest.CreatedAt)) {
+			newest = &c.Messages[i]
+		}
+	}
+	if newest == nil {
+		return nil
+	}
+	return &newest.ID
+}
+
+// Parse detects the export format and parses every conversation in it. A
+// conversation that fails to parse is returned with Err set, so one bad
+// entry does not stop the rest.
+func Parse(data []byte) (string, []Conversation, error) {
+	var probe any
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return "", nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	switch v := probe.(type) {
+	case map[string]any:
+		if v["format"] == export.Format {
+			return SourceT3Sesame, parseEach([]json.RawMessage{data}, parseT3Sesame), nil
+		}
+	case []any:
+		if len(v) == 0 {
+			return "", nil, ErrUnknownFormat
+		}
+		first, _ := v[0].(map[string]any)
+		var raws []json.RawMessage
+		if err := json.Unmarshal(data, &raws); err != nil {
+			return "", nil, err
+		}
+		switch {
+		case first["mapping"] != nil:
+			return SourceChatGPT, parseEach(raws, parseChatGPT), nil
+		case first["chat_messages"] != nil:
+			return SourceClaude, parseEach(raws, parseClaude), nil
+		}
+	}
+
+	return "", nil, ErrUnknownFormat
+}
+
+func parseEach(raws []json.RawMessage, parse func(json.RawMessage) (Conversation, error)) []Conversation {
+	convs := make([]Conversation, 0, len(raws))
+	for _, raw := range raws {
+		conv, err := parse(raw)
+		if err == nil && len(conv.Messages) == 0 {
+			err = errors.New("no messages")
+		}
+		if err == nil {
+			err = conv.validate()
+		}
+		conv.Err = err
+		conv.Title = cleanTitle(conv.Title)
+		convs = append(convs, conv)
+	}
+	return convs
+}
+
+func parseT3Sesame(raw json.RawMessage) (Conversation, error) {
+	var doc export.Document
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return Conversation{}, err
+	}
+	if doc.Version > export.Version {
+		return Conversation{}, fmt.Errorf("export version %d is newer than this server supports", doc.Version)
+	}
+
+	conv := Conversation{
+		Title:        doc.Conversation.Title,
+		CreatedAt:    doc.Conversation.CreatedAt,
+		UpdatedAt:    doc.Conversation.UpdatedAt,
+		ActiveLeafID: doc.Conversation.ActiveLeafID,
+		ModelRef:     doc.Conversation.Model,
+	}
+	for _, m := range doc.Messages {
+		msg := Message{
+			ID:        m.ID,
+			ParentID:  m.ParentID,
+			Role:      m.Role,
+			Parts:     withoutImages(m.Parts),
+			ModelRef:  m.Model,
+			CreatedAt: m.CreatedAt,
+		}
+		if m.Generation != nil {
+			msg.Generation = *m.Generation
+		}
+		conv.Messages = append(conv.Messages, msg)
+	}
+	return conv, nil
+}
+
+// validate checks what storing a conversation relies on: unique message
+// IDs, roles the database accepts, and parents that exist without forming
+// a cycle. Parse runs it for every format, so a dry run reports the same
+// problems the import would hit.
+func (c *Conversation) validate() error {
+	byID := make(map[int]Message, len(c.Messages))
+	for _, m := range c.Messages {
+		if _, ok := byID[m.ID]; ok {
+			return fmt.Errorf("message %d appears twice", m.ID)
+		}
+		byID[m.ID] = m
+		switch m.Role {
+		case models.RoleSystem, models.RoleUser, models.RoleAssistant, models.RoleTool:
+		default:
+			return fmt.Errorf("message %d has unknown role %q", m.ID, m.Role)
+		}
+	}
+
+	// Walk up from every message; meeting one twice on the way is a cycle
+	checked := map[int]bool{}
+	for _, m := range c.Messages {
+		seen := map[int]bool{}
+		for id := m.ID; !checked[id]; {
+			if seen[id] {
+				return fmt.Errorf("message %d is its own ancestor", id)
+			}
+			seen[id] = true
+			parent := byID[id].ParentID
+			if parent == nil {
+				break
+			}
+			if _, ok := byID[*parent]; !ok {
+				return fmt.Errorf("message %d refers to missing parent %d", id, *parent)
+			}
+			id = *parent
+		}
+		for id := range seen {
+			checked[id] = true
+		}
+	}
+	return nil
+}
+
+// Result reports what happened to one conversation of an import
+type Result struct {
+	Title    string
+	Messages int
+	Branches int
+	TreeID   int    // Set once stored
+	Error    string // Why it was skipped
+}
+
+// cleanTitle fits a title into the title column
+func cleanTitle(title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	if runes := []rune(title); len(runes) > maxTitleLength {
+		title = string(runes[:maxTitleLength])
+	}
+	if title == "" {
+		return models.DefaultTitle
+	}
+	return title
+}
+
+// withoutImages replaces image parts with a placeholder. Their blob keys
+// belong to the exporting server; kept here they would point at missing
+// images, or at someone else's that the importer once saw through a share.
+func withoutImages(parts models.Parts) models.Parts {
+	out := make(models.Parts, 0, len(parts))
+	for _, part := range parts {
+		if part.Type == models.PartImage {
+			part = models.ContentPart{Type: models.PartText, Text: attachmentPlaceholder}
+		}
+		out = append(out, part)
+	}
+	return out
+}
+
+func textParts(text string) models.Parts {
+	return models.Parts{{Type: models.PartText, Text: text}}
+}
@@ -0,0 +1,234 @@
+package importer
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseFixture(t *testing.T, name, wantSource string) []Conversation {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, convs, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse(%s): %v", name, err)
+	}
+	if source != wantSource {
+		t.Fatalf("Parse(%s) detected %q, want %q", name, source, wantSource)
+	}
+	return convs
+}
+
+// shape describes a message as "ID<-parent role: text", "ID role: text"
+// for roots, so a whole tree can be compared at once
+func shape(conv Conversation) []string {
+	var lines []string
+	for _, m := range conv.Messages {
+		line := strconv.Itoa(m.ID)
+		if m.ParentID != nil {
+			line += "<-" + strconv.Itoa(*m.ParentID)
+		}
+		lines = append(lines, line+" "+m.Role+": "+m.Parts.Text())
+	}
+	return lines
+}
+
+func expectShape(t *testing.T, conv Conversation, want ...string) {
+	t.Helper()
+	got := shape(conv)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("messages:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func expectActiveLeaf(t *testing.T, conv Conversation, want int) {
+	t.Helper()
+	if conv.ActiveLeafID == nil || *conv.ActiveLeafID != want {
+		t.Errorf("ActiveLeafID = %v, want %d", conv.ActiveLeafID, want)
+	}
+}
+
+func TestParseChatGPT(t *testing.T) {
+	convs := parseFixture(t, "chatgpt.json", SourceChatGPT)
+	if len(convs) != 2 {
+		t.Fatalf("got %d conversations, want 2", len(convs))
+	}
+
+	conv := convs[0]
+	if conv.Err != nil {
+		t.Fatalf("Err = %v", conv.Err)
+	}
+	if conv.Title != "What is Go?" {
+		t.Errorf("Title = %q", conv.Title)
+	}
+	if want := time.Unix(1700000000, 5e8).UTC(); !conv.CreatedAt.Equal(want) {
+		t.Errorf("CreatedAt = %v, want %v", conv.CreatedAt, want)
+	}
+	// The system prompt, the browser call and its result are dropped and
+	// the answer moves up to the question
+	expectShape(t, conv,
+		"1 user: What is Go?",
+		"2<-1 assistant: Go is a programming language.",
+		"3<-1 assistant: [attachment not included in export]\n\nA language from Google.",
+	)
+	expectActiveLeaf(t, conv, 2)
+	if conv.Branches() != 2 {
+		t.Errorf("Branches = %d, want 2", conv.Branches())
+	}
+
+	if convs[1].Err == nil {
+		t.Error("conversation without nodes parsed without error")
+	}
+}
+
+// Without a usable current_node the newest leaf is shown
+func TestParseChatGPTActiveLeafFallback(t *testing.T) {
+	data, err := os.ReadFile("testdata/chatgpt.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]func(conv map[string]any){
+		"missing":      func(conv map[string]any) { delete(conv, "current_node") },
+		"dropped node": func(conv map[string]any) { conv["current_node"] = "system" },
+		"unknown node": func(conv map[string]any) { conv["current_node"] = "gone" },
+	}
+	for name, edit := range tests {
+		var raws []map[string]any
+		if err := json.Unmarshal(data, &raws); err != nil {
+			t.Fatal(err)
+		}
+		edit(raws[0])
+		edited, _ := json.Marshal(raws[:1])
+
+		_, convs, err := Parse(edited)
+		if err != nil || len(convs) != 1 || convs[0].Err != nil {
+			t.Fatalf("%s: Parse = %+v, %v", name, convs, err)
+		}
+		// n4-answer is newer than n5-retry
+		if leaf := convs[0].ActiveLeafID; leaf == nil || *leaf != 2 {
+			t.Errorf("%s: ActiveLeafID = %v, want 2", name, leaf)
+		}
+	}
+}
+
+func TestParseClaude(t *testing.T) {
+	convs := parseFixture(t, "claude.json", SourceClaude)
+	if len(convs) != 2 {
+		t.Fatalf("got %d conversations, want 2", len(convs))
+	}
+
+	// The tool-only reply is dropped and its child attached to the question
+	conv := convs[0]
+	if conv.Err != nil {
+		t.Fatalf("Err = %v", conv.Err)
+	}
+	expectShape(t, conv,
+		"1 user: Summarise this article.",
+		"2<-1 assistant: It is about\n\ndatabases.",
+		"3<-2 user: Shorter please.",
+		"4<-1 assistant: Databases.",
+	)
+	expectActiveLeaf(t, conv, 4)
+	if conv.Branches() != 2 {
+		t.Errorf("Branches = %d, want 2", conv.Branches())
+	}
+
+	// Older exports without parent links are one branch in list order
+	old := convs[1]
+	if old.Err != nil {
+		t.Fatalf("Err = %v", old.Err)
+	}
+	if old.Title != "Old export" {
+		t.Errorf("Title = %q", old.Title)
+	}
+	expectShape(t, old,
+		"1 user: Hello",
+		"2<-1 assistant: Hi there!",
+	)
+	expectActiveLeaf(t, old, 2)
+}
+
+func TestParseT3Sesame(t *testing.T) {
+	convs := parseFixture(t, "t3sesame.json", SourceT3Sesame)
+	if len(convs) != 1 {
+		t.Fatalf("got %d conversations, want 1", len(convs))
+	}
+
+	conv := convs[0]
+	if conv.Err != nil {
+		t.Fatalf("Err = %v", conv.Err)
+	}
+	if conv.Title != "Branches" || conv.ModelRef != "openai/gpt-4o" {
+		t.Errorf("Title, ModelRef = %q, %q", conv.Title, conv.ModelRef)
+	}
+	// IDs are kept as exported; storing maps them
+	if len(conv.Messages) != 3 || conv.Branches() != 2 {
+		t.Fatalf("got %d messages on %d branches, want 3 on 2", len(conv.Messages), conv.Branches())
+	}
+	expectActiveLeaf(t, conv, 12)
+
+	answer := conv.Messages[0]
+	if answer.ModelRef != "openai/gpt-4o" || answer.Generation.FinishReason != "stop" ||
+		answer.Generation.PromptTokens != 5 {
+		t.Errorf("message 12 = %+v", answer)
+	}
+
+	// Image keys belong to the exporting server and are not kept
+	question := conv.Messages[1]
+	for _, part := range question.Parts {
+		if part.ImageRef != "" || part.ThumbnailRef != "" {
+			t.Errorf("image part kept: %+v", part)
+		}
+	}
+	if text := question.Parts.Text(); !strings.Contains(text, attachmentPlaceholder) {
+		t.Errorf("question text = %q, want the attachment placeholder", text)
+	}
+}
+
+func TestParseT3SesameValidates(t *testing.T) {
+	tests := map[string]string{
+		"unknown role": `{"id": 1, "role": "narrator", "parts": []}`,
+		"missing parent": `{"id": 1, "role": "user", "parts": []},
+			{"id": 2, "parent_id": 7, "role": "assistant", "parts": []}`,
+		"cycle": `{"id": 1, "parent_id": 2, "role": "user", "parts": []},
+			{"id": 2, "parent_id": 1, "role": "assistant", "parts": []}`,
+		"duplicate ID": `{"id": 1, "role": "user", "parts": []},
+			{"id": 1, "role": "assistant", "parts": []}`,
+		"no messages": ``,
+	}
+	for name, messages := range tests {
+		data := `{"format": "t3sesame.conversation", "version": 1,
+			"conversation": {"title": "Broken"}, "messages": [` + messages + `]}`
+		_, convs, err := Parse([]byte(data))
+		if err != nil {
+			t.Errorf("%s: Parse: %v", name, err)
+			continue
+		}
+		// Reported per conversation, so the dry run shows it too
+		if len(convs) != 1 || convs[0].Err == nil {
+			t.Errorf("%s: parsed without error", name)
+		}
+	}
+
+	_, convs, _ := Parse([]byte(`{"format": "t3sesame.conversation", "version": 99, "messages": []}`))
+	if len(convs) != 1 || convs[0].Err == nil || !strings.Contains(convs[0].Err.Error(), "newer") {
+		t.Errorf("newer export version not reported: %+v", convs)
+	}
+}
+
+func TestParseUnknownFormat(t *testing.T) {
+	for _, data := range []string{`[]`, `{"title": "x"}`, `[{"title": "x"}]`, `"text"`} {
+		if _, _, err := Parse([]byte(data)); err != ErrUnknownFormat {
+			t.Errorf("Parse(%s) = %v, want ErrUnknownFormat", data, err)
+		}
+	}
+	if _, _, err := Parse([]byte(`{`)); err == nil {
+		t.Error("invalid JSON parsed")
+	}
+}
@@ -0,0 +1,113 @@
+// Package indexer embeds new messages in the background so they can be
+// found by semantic search.
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"t3sesame/internal/llm"
+	"t3sesame/internal/models"
+)
+
+const (
+	defaultInterval = 5 * time.Second
+	batchSize       = 64
+	maxTextLength   = 8000 // Runes, keeps long replies within embedding limits
+)
+
+type Indexer struct {
+	embeddings *models.EmbeddingService
+	embedder   llm.Embedder
+	interval   time.Duration
+}
+
+func New(embeddings *models.EmbeddingService, embedder llm.Embedder) *Indexer {
+	return &Indexer{
+		embeddings: embeddings,
+		embedder:   embedder,
+		interval:   defaultInterval,
+	}
+}
+
+// Run indexes pending messages until ctx is cancelled. Backlogs are worked
+// off in consecutive batches, otherwise it polls every interval.
+func (ix *Indexer) Run(ctx context.Context) {
+	for {
+		n, err := ix.IndexPending(ctx)
+		if err != nil {
+			log.Printf("index messages with %s: %v", ix.embedder.Name(), err)
+		}
+		if err == nil && n == batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(ix.interval):
+		}
+	}
+}
+
+// IndexPending embeds one batch of messages and reports how many were
+// stored. When the batch fails as a whole the messages are embedded one by
+// one, so a message the embedder rejects is recorded as failed and skipped
+// instead of blocking everything after it.
+func (ix *Indexer) IndexPending(ctx context.Context) (int, error) {
+	pending, err := ix.embeddings.PendingMessages(ix.embedder.Name(), batchSize)
+	if err != nil || len(pending) == 0 {
+		return 0, err
+	}
+
+	texts := make([]string, len(pending))
+	for i, p := range pending {
+		texts[i] = p.Content
+		if runes := []rune(p.Content); len(runes) > maxTextLength {
+			texts[i] = string(runes[:maxTextLength])
+		}
+	}
+	vectors, err := ix.embedder.Embed(ctx, texts)
+	if err == nil && len(vectors) != len(texts) {
+		err = fmt.Errorf("got %d vectors for %d texts", len(vectors), len(texts))
+	}
+	if err != nil {
+		log.Printf("embed batch of %d messages with %s: %v", len(pending), ix.embedder.Name(), err)
+		return ix.indexOneByOne(ctx, pending, texts)
+	}
+
+	for i, p := range pending {
+		if err := ix.embeddings.SaveEmbedding(p.MessageID, ix.embedder.Name(), vectors[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(pending), nil
+}
+
+func (ix *Indexer) indexOneByOne(ctx context.Context, pending []models.PendingEmbedding, texts []string) (int, error) {
+	stored := 0
+	for i, p := range pending {
+		if err := ctx.Err(); err != nil {
+			return stored, err
+		}
+
+		vectors, err := ix.embedder.Embed(ctx, texts[i:i+1])
+		if err == nil && len(vectors) != 1 {
+			err = fmt.Errorf("got %d vectors for one text", len(vectors))
+		}
+		if err != nil {
+			if err := ix.embeddings.RecordFailure(p.MessageID, ix.embedder.Name(), err); err != nil {
+				return stored, err
+			}
+			continue
+		}
+
+		if err := ix.embeddings.SaveEmbedding(p.MessageID, ix.embedder.Name(), vectors[0]); err != nil {
+			return stored, err
+		}
+		stored++
+	}
+	return stored, nil
+}
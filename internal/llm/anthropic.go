@@ -0,0 +1,332 @@
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	DefaultAnthropicBaseURL = "https://api.anthropic.com"
+	anthropicVersion        = "2023-06-01"
+	// The Messages API requires max_tokens on every request
+	anthropicDefaultMaxTokens = 4096
+)
+
+// AnthropicProvider talks to the Anthropic Messages API
+type AnthropicProvider struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func NewAnthropicProvider(baseURL, apiKey string) *AnthropicProvider {
+	if baseURL == "" {
+		baseURL = DefaultAnthropicBaseURL
+	}
+	return &AnthropicProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  http.DefaultClient,
+	}
+}
+
+func (p *AnthropicProvider) Name() string {
+	return "anthropic"
+}
+
+type anthropicBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	Thinking  string          `json:"thinking,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	Source    *struct {
+		Type      string `json:"type"`
+		MediaType string `json:"media_type"`
+		Data      string `json:"data"`
+	} `json:"source,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	Tools       []anthropicTool    `json:"tools,omitempty"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature *float64           `json:"temperature,omitempty"`
+	Stream      bool               `json:"stream,omitempty"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type anthropicResponse struct {
+	ID         string           `json:"id"`
+	Model      string           `json:"model"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+// anthropicStreamEvent covers the fields of every event type in the stream
+type anthropicStreamEvent struct {
+	Type         string            `json:"type"`
+	Index        int               `json:"index"`
+	Message      anthropicResponse `json:"message"`
+	ContentBlock anthropicBlock    `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		Thinking    string `json:"thinking"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *anthropicUsage `json:"usage"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *AnthropicProvider) buildRequest(req Request, stream bool) anthropicRequest {
+	body := anthropicRequest{
+		Model:       req.Model,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		Stream:      stream,
+	}
+	if body.MaxTokens == 0 {
+		body.MaxTokens = anthropicDefaultMaxTokens
+	}
+
+	// The system prompt is a top level field rather than a turn
+	var system []string
+	if req.System != "" {
+		system = append(system, req.System)
+	}
+
+	for _, m := range req.Messages {
+		var role string
+		var blocks []anthropicBlock
+		switch m.Role {
+		case RoleSystem:
+			system = append(system, m.Content)
+			continue
+		case RoleTool:
+			// Tool results are sent back as user content
+			role = RoleUser
+			blocks = append(blocks, anthropicBlock{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Content})
+		default:
+			role = m.Role
+			// Images go first, which Anthropic recommends
+			for _, img := range m.Images {
+				block := anthropicBlock{Type: "image"}
+				block.Source = &struct {
+					Type      string `json:"type"`
+					MediaType string `json:"media_type"`
+					Data      string `json:"data"`
+				}{Type: "base64", MediaType: img.MimeType, Data: base64.StdEncoding.EncodeToString(img.Data)}
+				blocks = append(blocks, block)
+			}
+			if m.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: m.Content})
+			}
+			for _, tc := range m.ToolCalls {
+				input := json.RawMessage(tc.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: tc.ID, Name: tc.Name, Input: input})
+			}
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+
+		// Turns must alternate, so consecutive turns of one role are merged
+		if n := len(body.Messages); n > 0 && body.Messages[n-1].Role == role {
+			body.Messages[n-1].Content = append(body.Messages[n-1].Content, blocks...)
+			continue
+		}
+		body.Messages = append(body.Messages, anthropicMessage{Role: role, Content: blocks})
+	}
+	body.System = strings.Join(system, "\n\n")
+
+	for _, t := range req.Tools {
+		body.Tools = append(body.Tools, anthropicTool{Name: t.Name, Description: t.Description, InputSchema: t.Parameters})
+	}
+
+	return body
+}
+
+func (p *AnthropicProvider) headers() map[string]string {
+	return map[string]string{
+		"x-api-key":         p.apiKey,
+		"anthropic-version": anthropicVersion,
+	}
+}
+
+func (p *AnthropicProvider) Complete(ctx context.Context, req Request) (*Response, error) {
+	resp, err := postJSON(ctx, p.client, p.Name(), p.baseURL+"/v1/messages", p.headers(), p.buildRequest(req, false))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	out := &Response{
+		Model:        body.Model,
+		FinishReason: anthropicFinishReason(body.StopReason),
+		RequestID:    requestID(resp, body.ID),
+		Usage: Usage{
+			PromptTokens:     body.Usage.InputTokens,
+			CompletionTokens: body.Usage.OutputTokens,
+		},
+	}
+	var content strings.Builder
+	for _, block := range body.Content {
+		switch block.Type {
+		case "text":
+			content.WriteString(block.Text)
+		case "thinking":
+			out.Reasoning += block.Thinking
+		case "tool_use":
+			out.ToolCalls = append(out.ToolCalls, ToolCall{ID: block.ID, Name: block.Name, Arguments: string(block.Input)})
+		}
+	}
+	out.Content = content.String()
+
+	return out, nil
+}
+
+func (p *AnthropicProvider) Stream(ctx context.Context, req Request, onDelta func(string) error) (*Response, error) {
+	resp, err := postJSON(ctx, p.client, p.Name(), p.baseURL+"/v1/messages", p.headers(), p.buildRequest(req, true))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	out := &Response{Model: req.Model, RequestID: requestID(resp, "")}
+	var content, reasoning strings.Builder
+	// Tool input JSON arrives in fragments per content block index
+	calls := map[int]*ToolCall{}
+	var order []int
+
+	err = readSSE(resp.Body, func(ev sseEvent) error {
+		var event anthropicStreamEvent
+		if err := json.Unmarshal([]byte(ev.Data), &event); err != nil {
+			return err
+		}
+
+		switch event.Type {
+		case "message_start":
+			if out.RequestID == "" {
+				out.RequestID = event.Message.ID
+			}
+			if event.Message.Model != "" {
+				out.Model = event.Message.Model
+			}
+			out.Usage.PromptTokens = event.Message.Usage.InputTokens
+			out.Usage.CompletionTokens = event.Message.Usage.OutputTokens
+		case "content_block_start":
+			if event.ContentBlock.Type == "tool_use" {
+				calls[event.Index] = &ToolCall{ID: event.ContentBlock.ID, Name: event.ContentBlock.Name}
+				order = append(order, event.Index)
+			}
+		case "content_block_delta":
+			switch event.Delta.Type {
+			case "text_delta":
+				content.WriteString(event.Delta.Text)
+				if onDelta != nil {
+					return onDelta(event.Delta.Text)
+				}
+			case "thinking_delta":
+				reasoning.WriteString(event.Delta.Thinking)
+			case "input_json_delta":
+				if call, ok := calls[event.Index]; ok {
+					call.Arguments += event.Delta.PartialJSON
+				}
+			}
+		case "message_delta":
+			if event.Delta.StopReason != "" {
+				out.FinishReason = anthropicFinishReason(event.Delta.StopReason)
+			}
+			if event.Usage != nil {
+				out.Usage.CompletionTokens = event.Usage.OutputTokens
+			}
+		case "message_stop":
+			return errStreamDone
+		case "error":
+			msg := "stream error"
+			if event.Error != nil {
+				msg = event.Error.Message
+			}
+			return &APIError{Provider: p.Name(), StatusCode: resp.StatusCode, Message: msg}
+		}
+		return nil
+	})
+	switch {
+	case err == nil:
+		// The body ended before message_stop, so the reply is cut off
+		return nil, io.ErrUnexpectedEOF
+	case !errors.Is(err, errStreamDone):
+		return nil, err
+	}
+
+	out.Content = content.String()
+	out.Reasoning = reasoning.String()
+	for _, idx := range order {
+		out.ToolCalls = append(out.ToolCalls, *calls[idx])
+	}
+
+	return out, nil
+}
+
+func (p *AnthropicProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	var body struct {
+		Data []ModelInfo `json:"data"`
+	}
+	if err := getJSON(ctx, p.client, p.Name(), p.baseURL+"/v1/models", p.headers(), &body); err != nil {
+		return nil, err
+	}
+	return body.Data, nil
+}
+
+func anthropicFinishReason(stopReason string) string {
+	switch stopReason {
+	case "end_turn", "stop_sequence", "pause_turn":
+		return FinishStop
+	case "max_tokens":
+		return FinishLength
+	case "tool_use":
+		return FinishToolCalls
+	case "refusal":
+		return FinishContentFilter
+	}
+	return stopReason
+}
@@ -0,0 +1,227 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// recordedServer replays body as a text/event-stream response and keeps the
+// last request it received
+type recordedServer struct {
+	*httptest.Server
+	uri    string
+	header http.Header
+	body   []byte
+}
+
+func newRecordedServer(t *testing.T, status int, body string) *recordedServer {
+	t.Helper()
+	s := &recordedServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.uri = r.URL.RequestURI()
+		s.header = r.Header.Clone()
+		s.body, _ = io.ReadAll(r.Body)
+		if status == http.StatusOK {
+			w.Header().Set("Content-Type", "text/event-stream")
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// sse formats events the way the APIs send them
+func sse(events ...string) string {
+	var b strings.Builder
+	for _, ev := range events {
+		name, data, _ := strings.Cut(ev, "\n")
+		fmt.Fprintf(&b, "event: %s\ndata: %s\n\n", name, data)
+	}
+	return b.String()
+}
+
+func TestAnthropicStream(t *testing.T) {
+	server := newRecordedServer(t, http.StatusOK, sse(
+		"message_start\n"+`{"type":"message_start","message":{"id":"msg_1","model":"claude-test","usage":{"input_tokens":12,"output_tokens":1}}}`,
+		"content_block_start\n"+`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+		"content_block_delta\n"+`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"Let me "}}`,
+		"content_block_delta\n"+`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"check."}}`,
+		"content_block_start\n"+`{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`,
+		"content_block_delta\n"+`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Looking "}}`,
+		"content_block_delta\n"+`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"it up."}}`,
+		"content_block_start\n"+`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_1","name":"weather","input":{}}}`,
+		"content_block_delta\n"+`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"ci"}}`,
+		"content_block_delta\n"+`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"ty\": \"Par"}}`,
+		"content_block_delta\n"+`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"is\"}"}}`,
+		"content_block_stop\n"+`{"type":"content_block_stop","index":2}`,
+		"message_delta\n"+`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":42}}`,
+		"message_stop\n"+`{"type":"message_stop"}`,
+	))
+
+	p := NewAnthropicProvider(server.URL, "test-key")
+	var deltas []string
+	resp, err := p.Stream(context.Background(), Request{
+		Model:    "claude-test",
+		Messages: []Message{{Role: RoleUser, Content: "Weather in Paris?"}},
+	}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+
+	if got := strings.Join(deltas, "|"); got != "Looking |it up." {
+		t.Errorf("deltas = %q", got)
+	}
+	if resp.Content != "Looking it up." {
+		t.Errorf("Content = %q", resp.Content)
+	}
+	if resp.Reasoning != "Let me check." {
+		t.Errorf("Reasoning = %q", resp.Reasoning)
+	}
+	want := []ToolCall{{ID: "toolu_1", Name: "weather", Arguments: `{"city": "Paris"}`}}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0] != want[0] {
+		t.Errorf("ToolCalls = %+v, want %+v", resp.ToolCalls, want)
+	}
+	if resp.Usage != (Usage{PromptTokens: 12, CompletionTokens: 42}) {
+		t.Errorf("Usage = %+v", resp.Usage)
+	}
+	if resp.FinishReason != FinishToolCalls {
+		t.Errorf("FinishReason = %q", resp.FinishReason)
+	}
+	if resp.RequestID != "msg_1" || resp.Model != "claude-test" {
+		t.Errorf("RequestID, Model = %q, %q", resp.RequestID, resp.Model)
+	}
+
+	if got := server.header.Get("x-api-key"); got != "test-key" {
+		t.Errorf("x-api-key = %q", got)
+	}
+	if got := server.header.Get("anthropic-version"); got != anthropicVersion {
+		t.Errorf("anthropic-version = %q", got)
+	}
+	var sent anthropicRequest
+	if err := json.Unmarshal(server.body, &sent); err != nil {
+		t.Fatalf("request body: %v", err)
+	}
+	if !sent.Stream || sent.MaxTokens != anthropicDefaultMaxTokens {
+		t.Errorf("stream, max_tokens = %v, %d", sent.Stream, sent.MaxTokens)
+	}
+}
+
+func TestAnthropicStreamError(t *testing.T) {
+	server := newRecordedServer(t, http.StatusOK, sse(
+		"message_start\n"+`{"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":3}}}`,
+		"content_block_delta\n"+`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}`,
+		"error\n"+`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+	))
+
+	p := NewAnthropicProvider(server.URL, "test-key")
+	_, err := p.Stream(context.Background(), Request{Model: "claude-test"}, func(string) error { return nil })
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want *APIError", err)
+	}
+	if apiErr.Message != "Overloaded" || apiErr.Provider != "anthropic" {
+		t.Errorf("APIError = %+v", apiErr)
+	}
+}
+
+// Without message_stop the reply is cut off, even with a stop reason
+func TestAnthropicStreamCutOff(t *testing.T) {
+	server := newRecordedServer(t, http.StatusOK, sse(
+		"message_start\n"+`{"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":3}}}`,
+		"content_block_delta\n"+`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}`,
+		"message_delta\n"+`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":1}}`,
+	))
+
+	p := NewAnthropicProvider(server.URL, "test-key")
+	var streamed string
+	_, err := p.Stream(context.Background(), Request{Model: "claude-test"}, func(delta string) error {
+		streamed += delta
+		return nil
+	})
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("err = %v, want io.ErrUnexpectedEOF", err)
+	}
+	if streamed != "Hel" {
+		t.Errorf("streamed %q before the cut", streamed)
+	}
+}
+
+func TestAnthropicFinishReason(t *testing.T) {
+	tests := map[string]string{
+		"end_turn":      FinishStop,
+		"stop_sequence": FinishStop,
+		"pause_turn":    FinishStop,
+		"max_tokens":    FinishLength,
+		"tool_use":      FinishToolCalls,
+		"refusal":       FinishContentFilter,
+		"something_new": "something_new",
+	}
+	for in, want := range tests {
+		if got := anthropicFinishReason(in); got != want {
+			t.Errorf("anthropicFinishReason(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestAnthropicBuildRequest(t *testing.T) {
+	p := NewAnthropicProvider("", "key")
+	body := p.buildRequest(Request{
+		Model:  "claude-test",
+		System: "Be brief.",
+		Messages: []Message{
+			{Role: RoleSystem, Content: "Use metric units."},
+			{Role: RoleUser, Content: "Weather in Paris?"},
+			{Role: RoleUser, Content: "And Lyon?"},
+			{Role: RoleAssistant, ToolCalls: []ToolCall{
+				{ID: "toolu_1", Name: "weather", Arguments: `{"city":"Paris"}`},
+				{ID: "toolu_2", Name: "weather", Arguments: `not json`},
+			}},
+			{Role: RoleTool, ToolCallID: "toolu_1", Content: "18C"},
+			{Role: RoleTool, ToolCallID: "toolu_2", Content: "20C"},
+		},
+	}, false)
+
+	if body.System != "Be brief.\n\nUse metric units." {
+		t.Errorf("System = %q", body.System)
+	}
+	if len(body.Messages) != 3 {
+		t.Fatalf("got %d turns, want 3: %+v", len(body.Messages), body.Messages)
+	}
+
+	// Both user questions are merged into one turn
+	user := body.Messages[0]
+	if user.Role != RoleUser || len(user.Content) != 2 || user.Content[1].Text != "And Lyon?" {
+		t.Errorf("user turn = %+v", user)
+	}
+
+	calls := body.Messages[1]
+	if calls.Role != RoleAssistant || len(calls.Content) != 2 || calls.Content[0].Type != "tool_use" {
+		t.Fatalf("assistant turn = %+v", calls)
+	}
+	if string(calls.Content[1].Input) != "{}" {
+		t.Errorf("invalid arguments sent as %s, want {}", calls.Content[1].Input)
+	}
+
+	// Tool results go back as one user turn of tool_result blocks
+	results := body.Messages[2]
+	if results.Role != RoleUser || len(results.Content) != 2 {
+		t.Fatalf("tool result turn = %+v", results)
+	}
+	for i, id := range []string{"toolu_1", "toolu_2"} {
+		block := results.Content[i]
+		if block.Type != "tool_result" || block.ToolUseID != id {
+			t.Errorf("result %d = %+v", i, block)
+		}
+	}
+}
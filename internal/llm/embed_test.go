@@ -0,0 +1,91 @@
+package llm
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func embedOne(t *testing.T, e Embedder, text string) []float32 {
+	t.Helper()
+	vectors, err := e.Embed(context.Background(), []string{text})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(vectors) != 1 {
+		t.Fatalf("got %d vectors for one text", len(vectors))
+	}
+	return vectors[0]
+}
+
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+func TestHashEmbedderDeterministic(t *testing.T) {
+	text := "How do I configure the Postgres connection pool?"
+	a := embedOne(t, NewHashEmbedder(0), text)
+	b := embedOne(t, NewHashEmbedder(0), text)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("dimension %d differs between runs: %v != %v", i, a[i], b[i])
+		}
+	}
+}
+
+func TestHashEmbedderDimensions(t *testing.T) {
+	for _, dims := range []int{0, 16, 384} {
+		e := NewHashEmbedder(dims)
+		want := dims
+		if dims == 0 {
+			want = DefaultHashDimensions
+		}
+		vectors, err := e.Embed(context.Background(), []string{"one text", "", "another text"})
+		if err != nil {
+			t.Fatalf("Embed: %v", err)
+		}
+		if len(vectors) != 3 {
+			t.Fatalf("got %d vectors for 3 texts", len(vectors))
+		}
+		for _, v := range vectors {
+			if len(v) != want {
+				t.Errorf("NewHashEmbedder(%d) gave %d dimensions, want %d", dims, len(v), want)
+			}
+		}
+	}
+}
+
+func TestHashEmbedderUnitLength(t *testing.T) {
+	e := NewHashEmbedder(0)
+	for _, text := range []string{"hello", "The quick brown fox jumps over the lazy dog", "Zürich, 2024: 10 °C"} {
+		norm := math.Sqrt(dot(embedOne(t, e, text), embedOne(t, e, text)))
+		if math.Abs(norm-1) > 1e-5 {
+			t.Errorf("|embed(%q)| = %v, want 1", text, norm)
+		}
+	}
+
+	// Nothing to hash stays the zero vector rather than NaN
+	for _, x := range embedOne(t, e, " ... ") {
+		if x != 0 {
+			t.Fatalf("embedding of punctuation only = %v, want zeros", x)
+		}
+	}
+}
+
+func TestHashEmbedderSimilarity(t *testing.T) {
+	e := NewHashEmbedder(0)
+	query := embedOne(t, e, "How do I reset my password?")
+	similar := embedOne(t, e, "I forgot my password, how can I reset it?")
+	unrelated := embedOne(t, e, "Recipe for a chocolate cake with cherries")
+
+	if s, u := dot(query, similar), dot(query, unrelated); s <= u {
+		t.Errorf("similar text scored %v, unrelated text %v", s, u)
+	}
+	if s := dot(query, query); math.Abs(s-1) > 1e-5 {
+		t.Errorf("self similarity = %v, want 1", s)
+	}
+}
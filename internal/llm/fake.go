@@ -0,0 +1,82 @@
+package llm
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// FakeProvider answers deterministically without any network access. It is
+// the default when no real provider is configured and lets the whole send
+// path run offline.
+type FakeProvider struct{}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeProvider) Complete(ctx context.Context, req Request) (*Response, error) {
+	return p.Stream(ctx, req, nil)
+}
+
+func (p *FakeProvider) Stream(ctx context.Context, req Request, onDelta func(string) error) (*Response, error) {
+	reply := p.reply(req)
+
+	// Emit word by word so streaming consumers see more than one chunk
+	words := strings.SplitAfter(reply, " ")
+	for _, w := range words {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if onDelta != nil {
+			if err := onDelta(w); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &Response{
+		Model:        req.Model,
+		Content:      reply,
+		FinishReason: FinishStop,
+		Usage: Usage{
+			PromptTokens:     countWords(req),
+			CompletionTokens: len(words),
+		},
+	}, nil
+}
+
+func (p *FakeProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	return []ModelInfo{{ID: "echo", DisplayName: "Echo (offline)"}}, nil
+}
+
+func (p *FakeProvider) reply(req Request) string {
+	var last Message
+	turns := 0
+	for _, m := range req.Messages {
+		if m.Role == RoleUser {
+			last = m
+			turns++
+		}
+	}
+	if turns == 0 {
+		return "Hello! Send me a message to get started."
+	}
+	reply := "You said: \"" + last.Content + "\" (turn " + strconv.Itoa(turns) + ")"
+	if n := len(last.Images); n > 0 {
+		reply += " and sent " + strconv.Itoa(n) + " image(s)"
+	}
+	return reply
+}
+
+func countWords(req Request) int {
+	n := len(strings.Fields(req.System))
+	for _, m := range req.Messages {
+		n += len(strings.Fields(m.Content))
+	}
+	return n
+}
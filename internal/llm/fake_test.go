@@ -0,0 +1,71 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestFakeProviderThroughRegistry(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(NewFakeProvider())
+
+	discovered := registry.Discover(context.Background())
+	if len(discovered) != 1 || !discovered[0].Available || discovered[0].Models[0].ID != "echo" {
+		t.Fatalf("Discover = %+v", discovered)
+	}
+
+	provider, model, err := registry.Resolve("fake/echo")
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if model != "echo" {
+		t.Errorf("model = %q, want echo", model)
+	}
+
+	var deltas []string
+	resp, err := provider.Stream(context.Background(), Request{
+		Model: model,
+		Messages: []Message{
+			{Role: RoleUser, Content: "Hi"},
+			{Role: RoleAssistant, Content: "Hello!"},
+			{Role: RoleUser, Content: "How are you?"},
+		},
+	}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+
+	want := `You said: "How are you?" (turn 2)`
+	if resp.Content != want {
+		t.Errorf("Content = %q, want %q", resp.Content, want)
+	}
+	if len(deltas) < 2 || strings.Join(deltas, "") != want {
+		t.Errorf("deltas = %q", deltas)
+	}
+	if resp.FinishReason != FinishStop || resp.Model != "echo" || resp.Usage.CompletionTokens != len(deltas) {
+		t.Errorf("FinishReason, Model, Usage = %q, %q, %+v", resp.FinishReason, resp.Model, resp.Usage)
+	}
+
+	if _, _, err := registry.Resolve("missing/echo"); err == nil {
+		t.Error("Resolve found an unregistered provider")
+	}
+}
+
+func TestFakeProviderStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	_, err := NewFakeProvider().Stream(ctx, Request{
+		Messages: []Message{{Role: RoleUser, Content: "a long enough message"}},
+	}, func(string) error {
+		calls++
+		cancel()
+		return nil
+	})
+	if err != context.Canceled || calls != 1 {
+		t.Errorf("err, calls = %v, %d; want context.Canceled after one delta", err, calls)
+	}
+}
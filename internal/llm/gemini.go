@@ -0,0 +1,397 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+)
+
+const DefaultGeminiBaseURL = "https://generativelanguage.googleapis.com"
+
+// GeminiProvider talks to the Gemini generateContent API
+type GeminiProvider struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func NewGeminiProvider(baseURL, apiKey string) *GeminiProvider {
+	if baseURL == "" {
+		baseURL = DefaultGeminiBaseURL
+	}
+	return &GeminiProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  http.DefaultClient,
+	}
+}
+
+func (p *GeminiProvider) Name() string {
+	return "gemini"
+}
+
+type geminiPart struct {
+	Text       string `json:"text,omitempty"`
+	InlineData *struct {
+		MimeType string `json:"mimeType"`
+		Data     string `json:"data"`
+	} `json:"inlineData,omitempty"`
+	FunctionCall *struct {
+		Name string          `json:"name"`
+		Args json.RawMessage `json:"args"`
+	} `json:"functionCall,omitempty"`
+	FunctionResponse *struct {
+		Name     string          `json:"name"`
+		Response json.RawMessage `json:"response"`
+	} `json:"functionResponse,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiRequest struct {
+	Contents          []geminiContent `json:"contents"`
+	SystemInstruction *geminiContent  `json:"systemInstruction,omitempty"`
+	Tools             []struct {
+		FunctionDeclarations []Tool `json:"functionDeclarations"`
+	} `json:"tools,omitempty"`
+	GenerationConfig struct {
+		MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+		Temperature     *float64 `json:"temperature,omitempty"`
+	} `json:"generationConfig"`
+}
+
+type geminiSafetyRating struct {
+	Category string `json:"category"`
+	Blocked  bool   `json:"blocked"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content       geminiContent        `json:"content"`
+		FinishReason  string               `json:"finishReason"`
+		SafetyRatings []geminiSafetyRating `json:"safetyRatings"`
+	} `json:"candidates"`
+	PromptFeedback *struct {
+		BlockReason   string               `json:"blockReason"`
+		SafetyRatings []geminiSafetyRating `json:"safetyRatings"`
+	} `json:"promptFeedback"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
+	ModelVersion string `json:"modelVersion"`
+	ResponseID   string `json:"responseId"`
+}
+
+func (p *GeminiProvider) buildRequest(req Request) geminiRequest {
+	var body geminiRequest
+	body.GenerationConfig.MaxOutputTokens = req.MaxTokens
+	body.GenerationConfig.Temperature = req.Temperature
+
+	var system []geminiPart
+	if req.System != "" {
+		system = append(system, geminiPart{Text: req.System})
+	}
+
+	for _, m := range req.Messages {
+		var role string
+		var parts []geminiPart
+		switch m.Role {
+		case RoleSystem:
+			system = append(system, geminiPart{Text: m.Content})
+			continue
+		case RoleAssistant:
+			role = "model"
+		default:
+			role = RoleUser
+		}
+
+		if m.Role == RoleTool {
+			// Gemini has no call IDs; tool calls are matched by function name
+			part := geminiPart{FunctionResponse: &struct {
+				Name     string          `json:"name"`
+				Response json.RawMessage `json:"response"`
+			}{Name: m.ToolCallID, Response: geminiToolResult(m.Content)}}
+			parts = append(parts, part)
+		} else if m.Content != "" {
+			parts = append(parts, geminiPart{Text: m.Content})
+		}
+		for _, img := range m.Images {
+			parts = append(parts, geminiPart{InlineData: &struct {
+				MimeType string `json:"mimeType"`
+				Data     string `json:"data"`
+			}{MimeType: img.MimeType, Data: base64.StdEncoding.EncodeToString(img.Data)}})
+		}
+		for _, tc := range m.ToolCalls {
+			args := json.RawMessage(tc.Arguments)
+			if !json.Valid(args) {
+				args = json.RawMessage("{}")
+			}
+			parts = append(parts, geminiPart{FunctionCall: &struct {
+				Name string          `json:"name"`
+				Args json.RawMessage `json:"args"`
+			}{Name: tc.Name, Args: args}})
+		}
+		if len(parts) == 0 {
+			continue
+		}
+
+		if n := len(body.Contents); n > 0 && body.Contents[n-1].Role == role {
+			body.Contents[n-1].Parts = append(body.Contents[n-1].Parts, parts...)
+			continue
+		}
+		body.Contents = append(body.Contents, geminiContent{Role: role, Parts: parts})
+	}
+	if len(system) > 0 {
+		body.SystemInstruction = &geminiContent{Parts: system}
+	}
+
+	if len(req.Tools) > 0 {
+		body.Tools = append(body.Tools, struct {
+			FunctionDeclarations []Tool `json:"functionDeclarations"`
+		}{FunctionDeclarations: req.Tools})
+	}
+
+	return body
+}
+
+// geminiToolResult wraps plain text results, since the API wants an object
+func geminiToolResult(content string) json.RawMessage {
+	if trimmed := strings.TrimSpace(content); strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed)) {
+		return json.RawMessage(trimmed)
+	}
+	wrapped, _ := json.Marshal(map[string]string{"result": content})
+	return wrapped
+}
+
+func (p *GeminiProvider) post(ctx context.Context, method string, query url.Values, body any) (*http.Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url(method, query), bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-goog-api-key", p.apiKey)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkResponse(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (p *GeminiProvider) url(path string, query url.Values) string {
+	u := p.baseURL + "/v1beta/" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// checkResponse decodes Google's error envelope via googleapi
+func (p *GeminiProvider) checkResponse(resp *http.Response) error {
+	err := googleapi.CheckResponse(resp)
+	if err == nil {
+		return nil
+	}
+	resp.Body.Close()
+
+	if gerr, ok := err.(*googleapi.Error); ok {
+		msg := gerr.Message
+		if msg == "" {
+			msg = strings.TrimSpace(gerr.Body)
+		}
+		return &APIError{Provider: p.Name(), StatusCode: gerr.Code, Message: msg}
+	}
+	return err
+}
+
+func (p *GeminiProvider) Complete(ctx context.Context, req Request) (*Response, error) {
+	resp, err := p.post(ctx, "models/"+req.Model+":generateContent", nil, p.buildRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body geminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	out := &Response{Model: req.Model}
+	var content strings.Builder
+	if err := p.accumulate(out, &content, body, nil); err != nil {
+		return nil, err
+	}
+	out.Content = content.String()
+
+	return out, nil
+}
+
+func (p *GeminiProvider) Stream(ctx context.Context, req Request, onDelta func(string) error) (*Response, error) {
+	query := url.Values{"alt": {"sse"}}
+	resp, err := p.post(ctx, "models/"+req.Model+":streamGenerateContent", query, p.buildRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	out := &Response{Model: req.Model}
+	var content strings.Builder
+	err = readSSE(resp.Body, func(ev sseEvent) error {
+		var chunk geminiResponse
+		if err := json.Unmarshal([]byte(ev.Data), &chunk); err != nil {
+			return err
+		}
+		return p.accumulate(out, &content, chunk, onDelta)
+	})
+	if err != nil {
+		return nil, err
+	}
+	out.Content = content.String()
+
+	return out, nil
+}
+
+// accumulate folds one response, or one streamed chunk of it, into out
+func (p *GeminiProvider) accumulate(out *Response, content *strings.Builder, chunk geminiResponse, onDelta func(string) error) error {
+	if chunk.ModelVersion != "" {
+		out.Model = chunk.ModelVersion
+	}
+	if chunk.ResponseID != "" {
+		out.RequestID = chunk.ResponseID
+	}
+	if chunk.UsageMetadata.PromptTokenCount > 0 {
+		out.Usage.PromptTokens = chunk.UsageMetadata.PromptTokenCount
+	}
+	if chunk.UsageMetadata.CandidatesTokenCount > 0 {
+		out.Usage.CompletionTokens = chunk.UsageMetadata.CandidatesTokenCount
+	}
+
+	// The prompt itself was refused, so there are no candidates
+	if fb := chunk.PromptFeedback; fb != nil && fb.BlockReason != "" {
+		return &BlockedError{Provider: "Gemini", Reason: geminiBlockReason(fb.BlockReason, fb.SafetyRatings)}
+	}
+	if len(chunk.Candidates) == 0 {
+		return nil
+	}
+
+	candidate := chunk.Candidates[0]
+	for _, part := range candidate.Content.Parts {
+		if part.FunctionCall != nil {
+			out.ToolCalls = append(out.ToolCalls, ToolCall{
+				ID:        part.FunctionCall.Name,
+				Name:      part.FunctionCall.Name,
+				Arguments: string(part.FunctionCall.Args),
+			})
+		}
+		if part.Text == "" {
+			continue
+		}
+		content.WriteString(part.Text)
+		if onDelta != nil {
+			if err := onDelta(part.Text); err != nil {
+				return err
+			}
+		}
+	}
+
+	if candidate.FinishReason != "" {
+		out.FinishReason = geminiFinishReason(candidate.FinishReason)
+		// Partial text is kept, an answer blocked outright becomes an error
+		if out.FinishReason == FinishContentFilter && content.Len() == 0 {
+			return &BlockedError{Provider: "Gemini", Reason: geminiBlockReason(candidate.FinishReason, candidate.SafetyRatings)}
+		}
+	}
+	if len(out.ToolCalls) > 0 {
+		out.FinishReason = FinishToolCalls
+	}
+
+	return nil
+}
+
+func (p *GeminiProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url("models", url.Values{"pageSize": {"1000"}}), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-goog-api-key", p.apiKey)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkResponse(resp); err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Models []struct {
+			Name                       string   `json:"name"`
+			DisplayName                string   `json:"displayName"`
+			SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	var models []ModelInfo
+	for _, m := range body.Models {
+		// Skip embedding and other non chat models
+		if !slices.Contains(m.SupportedGenerationMethods, "generateContent") {
+			continue
+		}
+		models = append(models, ModelInfo{
+			ID:          strings.TrimPrefix(m.Name, "models/"),
+			DisplayName: m.DisplayName,
+		})
+	}
+	return models, nil
+}
+
+func geminiFinishReason(reason string) string {
+	switch reason {
+	case "STOP":
+		return FinishStop
+	case "MAX_TOKENS":
+		return FinishLength
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return FinishContentFilter
+	}
+	return strings.ToLower(reason)
+}
+
+// geminiBlockReason turns block reasons and flagged categories such as
+// HARM_CATEGORY_DANGEROUS_CONTENT into something a user can read
+func geminiBlockReason(reason string, ratings []geminiSafetyRating) string {
+	var categories []string
+	for _, r := range ratings {
+		if r.Blocked {
+			name := strings.TrimPrefix(r.Category, "HARM_CATEGORY_")
+			categories = append(categories, strings.ReplaceAll(strings.ToLower(name), "_", " "))
+		}
+	}
+	if len(categories) > 0 {
+		return strings.Join(categories, ", ")
+	}
+	return strings.ReplaceAll(strings.ToLower(reason), "_", " ")
+}
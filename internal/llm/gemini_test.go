@@ -0,0 +1,141 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestGeminiStream(t *testing.T) {
+	server := newRecordedServer(t, http.StatusOK, sseData(
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"Bonjour"}]}}],"modelVersion":"gemini-test-001","responseId":"resp-1"}`,
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":" Paris"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":9,"candidatesTokenCount":4}}`,
+	))
+
+	p := NewGeminiProvider(server.URL, "g-key")
+	var deltas []string
+	resp, err := p.Stream(context.Background(), Request{Model: "gemini-test"}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	if len(deltas) != 2 || resp.Content != "Bonjour Paris" {
+		t.Errorf("deltas, Content = %q, %q", deltas, resp.Content)
+	}
+	if resp.FinishReason != FinishStop || resp.Usage != (Usage{PromptTokens: 9, CompletionTokens: 4}) {
+		t.Errorf("FinishReason, Usage = %q, %+v", resp.FinishReason, resp.Usage)
+	}
+	if resp.Model != "gemini-test-001" || resp.RequestID != "resp-1" {
+		t.Errorf("Model, RequestID = %q, %q", resp.Model, resp.RequestID)
+	}
+	if server.uri != "/v1beta/models/gemini-test:streamGenerateContent?alt=sse" {
+		t.Errorf("request URI = %q", server.uri)
+	}
+	if got := server.header.Get("x-goog-api-key"); got != "g-key" {
+		t.Errorf("x-goog-api-key = %q", got)
+	}
+}
+
+func TestGeminiPromptBlocked(t *testing.T) {
+	server := newRecordedServer(t, http.StatusOK, sseData(
+		`{"promptFeedback":{"blockReason":"SAFETY","safetyRatings":[`+
+			`{"category":"HARM_CATEGORY_DANGEROUS_CONTENT","probability":"HIGH","blocked":true},`+
+			`{"category":"HARM_CATEGORY_HARASSMENT","probability":"NEGLIGIBLE"}]},`+
+			`"usageMetadata":{"promptTokenCount":5}}`,
+	))
+
+	p := NewGeminiProvider(server.URL, "g-key")
+	_, err := p.Stream(context.Background(), Request{Model: "gemini-test"}, nil)
+	var blocked *BlockedError
+	if !errors.As(err, &blocked) {
+		t.Fatalf("err = %v, want *BlockedError", err)
+	}
+	if blocked.Provider != "Gemini" || blocked.Reason != "dangerous content" {
+		t.Errorf("BlockedError = %+v", blocked)
+	}
+}
+
+func TestGeminiAnswerBlocked(t *testing.T) {
+	server := newRecordedServer(t, http.StatusOK, sseData(
+		`{"candidates":[{"content":{"role":"model","parts":[]},"finishReason":"SAFETY"}]}`,
+	))
+
+	p := NewGeminiProvider(server.URL, "g-key")
+	_, err := p.Stream(context.Background(), Request{Model: "gemini-test"}, nil)
+	var blocked *BlockedError
+	if !errors.As(err, &blocked) {
+		t.Fatalf("err = %v, want *BlockedError", err)
+	}
+	if blocked.Reason != "safety" {
+		t.Errorf("Reason = %q", blocked.Reason)
+	}
+
+	// Text streamed before the block is kept as a filtered answer
+	server = newRecordedServer(t, http.StatusOK, sseData(
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"Partial"}]}}]}`,
+		`{"candidates":[{"content":{"role":"model","parts":[]},"finishReason":"SAFETY"}]}`,
+	))
+	p = NewGeminiProvider(server.URL, "g-key")
+	resp, err := p.Stream(context.Background(), Request{Model: "gemini-test"}, nil)
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	if resp.Content != "Partial" || resp.FinishReason != FinishContentFilter {
+		t.Errorf("Content, FinishReason = %q, %q", resp.Content, resp.FinishReason)
+	}
+}
+
+func TestGeminiBuildRequest(t *testing.T) {
+	server := newRecordedServer(t, http.StatusOK, sseData(
+		`{"candidates":[{"content":{"role":"model","parts":[{"text":"18C"}]},"finishReason":"STOP"}]}`,
+	))
+
+	p := NewGeminiProvider(server.URL, "g-key")
+	_, err := p.Stream(context.Background(), Request{
+		Model:  "gemini-test",
+		System: "Be brief.",
+		Messages: []Message{
+			{Role: RoleSystem, Content: "Use metric units."},
+			{Role: RoleUser, Content: "Weather in Paris?"},
+			{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "weather", Name: "weather", Arguments: `{"city":"Paris"}`}}},
+			{Role: RoleTool, ToolCallID: "weather", Content: "18C"},
+			{Role: RoleAssistant, Content: "It is 18C."},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+
+	var sent geminiRequest
+	if err := json.Unmarshal(server.body, &sent); err != nil {
+		t.Fatalf("request body: %v", err)
+	}
+
+	system := sent.SystemInstruction
+	if system == nil || len(system.Parts) != 2 || system.Parts[0].Text != "Be brief." || system.Parts[1].Text != "Use metric units." {
+		t.Errorf("systemInstruction = %+v", system)
+	}
+
+	roles := make([]string, len(sent.Contents))
+	for i, c := range sent.Contents {
+		roles[i] = c.Role
+	}
+	if len(roles) != 4 || roles[0] != "user" || roles[1] != "model" || roles[2] != "user" || roles[3] != "model" {
+		t.Fatalf("roles = %q, want user, model, user, model", roles)
+	}
+
+	call := sent.Contents[1].Parts[0].FunctionCall
+	if call == nil || call.Name != "weather" || string(call.Args) != `{"city":"Paris"}` {
+		t.Errorf("functionCall = %+v", call)
+	}
+
+	// Tool results go back as a user turn, plain text wrapped in an object
+	result := sent.Contents[2].Parts[0].FunctionResponse
+	if result == nil || result.Name != "weather" || string(result.Response) != `{"result":"18C"}` {
+		t.Errorf("functionResponse = %+v", result)
+	}
+}
@@ -0,0 +1,191 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const DefaultOllamaBaseURL = "http://localhost:11434"
+
+// OllamaProvider talks to a local Ollama server
+type OllamaProvider struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewOllamaProvider(baseURL string) *OllamaProvider {
+	if baseURL == "" {
+		baseURL = DefaultOllamaBaseURL
+	}
+	return &OllamaProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  http.DefaultClient,
+	}
+}
+
+func (p *OllamaProvider) Name() string {
+	return "ollama"
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	Images    []string         `json:"images,omitempty"` // Base64, no data URL prefix
+}
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Tools    []openAITool    `json:"tools,omitempty"`
+	Stream   bool            `json:"stream"`
+	Options  struct {
+		NumPredict  int      `json:"num_predict,omitempty"`
+		Temperature *float64 `json:"temperature,omitempty"`
+	} `json:"options"`
+}
+
+// ollamaChunk is one NDJSON line of /api/chat, the last one has Done set
+type ollamaChunk struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+func (p *OllamaProvider) buildRequest(req Request, stream bool) ollamaRequest {
+	body := ollamaRequest{Model: req.Model, Stream: stream}
+	body.Options.NumPredict = req.MaxTokens
+	body.Options.Temperature = req.Temperature
+
+	if req.System != "" {
+		body.Messages = append(body.Messages, ollamaMessage{Role: RoleSystem, Content: req.System})
+	}
+	for _, m := range req.Messages {
+		msg := ollamaMessage{Role: m.Role, Content: m.Content}
+		for _, img := range m.Images {
+			msg.Images = append(msg.Images, base64.StdEncoding.EncodeToString(img.Data))
+		}
+		for _, tc := range m.ToolCalls {
+			var call ollamaToolCall
+			call.Function.Name = tc.Name
+			call.Function.Arguments = json.RawMessage(tc.Arguments)
+			if !json.Valid(call.Function.Arguments) {
+				call.Function.Arguments = json.RawMessage("{}")
+			}
+			msg.ToolCalls = append(msg.ToolCalls, call)
+		}
+		body.Messages = append(body.Messages, msg)
+	}
+	for _, t := range req.Tools {
+		body.Tools = append(body.Tools, openAITool{Type: "function", Function: t})
+	}
+
+	return body
+}
+
+func (p *OllamaProvider) Complete(ctx context.Context, req Request) (*Response, error) {
+	return p.chat(ctx, req, false, nil)
+}
+
+func (p *OllamaProvider) Stream(ctx context.Context, req Request, onDelta func(string) error) (*Response, error) {
+	return p.chat(ctx, req, true, onDelta)
+}
+
+// chat reads /api/chat line by line. A non streaming answer is simply a
+// single line with Done set.
+func (p *OllamaProvider) chat(ctx context.Context, req Request, stream bool, onDelta func(string) error) (*Response, error) {
+	resp, err := postJSON(ctx, p.client, p.Name(), p.baseURL+"/api/chat", nil, p.buildRequest(req, stream))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	out := &Response{Model: req.Model}
+	var content strings.Builder
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var chunk ollamaChunk
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			return nil, err
+		}
+		if chunk.Error != "" {
+			return nil, &APIError{Provider: p.Name(), StatusCode: resp.StatusCode, Message: chunk.Error}
+		}
+		if chunk.Model != "" {
+			out.Model = chunk.Model
+		}
+
+		for _, tc := range chunk.Message.ToolCalls {
+			// Ollama has no call IDs, so the function name stands in
+			out.ToolCalls = append(out.ToolCalls, ToolCall{
+				ID:        tc.Function.Name,
+				Name:      tc.Function.Name,
+				Arguments: string(tc.Function.Arguments),
+			})
+		}
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			if onDelta != nil {
+				if err := onDelta(chunk.Message.Content); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if chunk.Done {
+			out.FinishReason = chunk.DoneReason
+			out.Usage = Usage{PromptTokens: chunk.PromptEvalCount, CompletionTokens: chunk.EvalCount}
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	out.Content = content.String()
+	if len(out.ToolCalls) > 0 {
+		out.FinishReason = FinishToolCalls
+	}
+
+	return out, nil
+}
+
+// ListModels returns whatever has been pulled into the local Ollama
+func (p *OllamaProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	var body struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := getJSON(ctx, p.client, p.Name(), p.baseURL+"/api/tags", nil, &body); err != nil {
+		return nil, err
+	}
+
+	models := make([]ModelInfo, 0, len(body.Models))
+	for _, m := range body.Models {
+		models = append(models, ModelInfo{ID: m.Name, DisplayName: m.Name})
+	}
+	return models, nil
+}
@@ -0,0 +1,325 @@
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+var errStreamDone = errors.New("stream done")
+
+// OpenAIProvider speaks the /v1/chat/completions wire format. Besides OpenAI
+// itself this covers OpenRouter, vLLM, LM Studio and llama.cpp servers, which
+// only differ in base URL and key.
+type OpenAIProvider struct {
+	name    string
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func NewOpenAIProvider(name, baseURL, apiKey string) *OpenAIProvider {
+	if baseURL == "" {
+		baseURL = DefaultOpenAIBaseURL
+	}
+	return &OpenAIProvider{
+		name:    name,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  http.DefaultClient,
+	}
+}
+
+func (p *OpenAIProvider) Name() string {
+	return p.name
+}
+
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    *string          `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+	// Not part of the OpenAI API, but sent by DeepSeek, vLLM and others
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+	// Replaces Content when images are sent along
+	Parts []openAIContentPart `json:"-"`
+}
+
+type openAIContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL *struct {
+		URL string `json:"url"`
+	} `json:"image_url,omitempty"`
+}
+
+// MarshalJSON sends Parts as the content array when there are any
+func (m openAIMessage) MarshalJSON() ([]byte, error) {
+	type plain openAIMessage
+	if len(m.Parts) == 0 {
+		return json.Marshal(plain(m))
+	}
+	return json.Marshal(struct {
+		plain
+		Content []openAIContentPart `json:"content"`
+	}{plain(m), m.Parts})
+}
+
+type openAIToolCall struct {
+	Index    *int   `json:"index,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type openAITool struct {
+	Type     string `json:"type"`
+	Function Tool   `json:"function"`
+}
+
+type openAIRequest struct {
+	Model         string          `json:"model"`
+	Messages      []openAIMessage `json:"messages"`
+	Tools         []openAITool    `json:"tools,omitempty"`
+	MaxTokens     int             `json:"max_tokens,omitempty"`
+	Temperature   *float64        `json:"temperature,omitempty"`
+	Stream        bool            `json:"stream,omitempty"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options,omitempty"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+type openAIResponse struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Message      openAIMessage `json:"message"`
+		Delta        openAIMessage `json:"delta"`
+		FinishReason *string       `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+func (p *OpenAIProvider) buildRequest(req Request, stream bool) openAIRequest {
+	body := openAIRequest{
+		Model:       req.Model,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		Stream:      stream,
+	}
+	if stream {
+		body.StreamOptions = &struct {
+			IncludeUsage bool `json:"include_usage"`
+		}{IncludeUsage: true}
+	}
+
+	if req.System != "" {
+		system := req.System
+		body.Messages = append(body.Messages, openAIMessage{Role: RoleSystem, Content: &system})
+	}
+	for _, m := range req.Messages {
+		content := m.Content
+		msg := openAIMessage{Role: m.Role, Content: &content, ToolCallID: m.ToolCallID}
+		for _, tc := range m.ToolCalls {
+			call := openAIToolCall{ID: tc.ID, Type: "function"}
+			call.Function.Name = tc.Name
+			call.Function.Arguments = tc.Arguments
+			msg.ToolCalls = append(msg.ToolCalls, call)
+		}
+		if len(m.Images) > 0 {
+			if content != "" {
+				msg.Parts = append(msg.Parts, openAIContentPart{Type: "text", Text: content})
+			}
+			for _, img := range m.Images {
+				part := openAIContentPart{Type: "image_url", ImageURL: &struct {
+					URL string `json:"url"`
+				}{URL: "data:" + img.MimeType + ";base64," + base64.StdEncoding.EncodeToString(img.Data)}}
+				msg.Parts = append(msg.Parts, part)
+			}
+		}
+		// Assistant turns that only call tools carry no content
+		if m.Role == RoleAssistant && content == "" && len(msg.ToolCalls) > 0 {
+			msg.Content = nil
+		}
+		body.Messages = append(body.Messages, msg)
+	}
+	for _, t := range req.Tools {
+		body.Tools = append(body.Tools, openAITool{Type: "function", Function: t})
+	}
+
+	return body
+}
+
+func (p *OpenAIProvider) headers() map[string]string {
+	headers := map[string]string{}
+	if p.apiKey != "" {
+		headers["Authorization"] = "Bearer " + p.apiKey
+	}
+	return headers
+}
+
+func (p *OpenAIProvider) Complete(ctx context.Context, req Request) (*Response, error) {
+	resp, err := postJSON(ctx, p.client, p.name, p.baseURL+"/chat/completions", p.headers(), p.buildRequest(req, false))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body openAIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	if len(body.Choices) == 0 {
+		return nil, &APIError{Provider: p.name, StatusCode: resp.StatusCode, Message: "no choices in response"}
+	}
+
+	choice := body.Choices[0]
+	out := &Response{
+		Model:     body.Model,
+		RequestID: requestID(resp, body.ID),
+	}
+	if choice.Message.Content != nil {
+		out.Content = *choice.Message.Content
+	}
+	out.Reasoning = choice.Message.ReasoningContent
+	if choice.FinishReason != nil {
+		out.FinishReason = *choice.FinishReason
+	}
+	for _, tc := range choice.Message.ToolCalls {
+		out.ToolCalls = append(out.ToolCalls, ToolCall{ID: tc.ID, Name: tc.Function.Name, Arguments: tc.Function.Arguments})
+	}
+	if body.Usage != nil {
+		out.Usage = Usage(*body.Usage)
+	}
+
+	return out, nil
+}
+
+func (p *OpenAIProvider) Stream(ctx context.Context, req Request, onDelta func(string) error) (*Response, error) {
+	resp, err := postJSON(ctx, p.client, p.name, p.baseURL+"/chat/completions", p.headers(), p.buildRequest(req, true))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	out := &Response{Model: req.Model}
+	var content, reasoning strings.Builder
+	// Tool call fragments arrive keyed by index and are stitched together
+	calls := map[int]*ToolCall{}
+
+	err = readSSE(resp.Body, func(ev sseEvent) error {
+		if ev.Data == "[DONE]" {
+			return errStreamDone
+		}
+
+		var chunk openAIResponse
+		if err := json.Unmarshal([]byte(ev.Data), &chunk); err != nil {
+			return err
+		}
+		if out.RequestID == "" {
+			out.RequestID = requestID(resp, chunk.ID)
+		}
+		if chunk.Model != "" {
+			out.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			out.Usage = Usage(*chunk.Usage)
+		}
+
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != nil && *choice.FinishReason != "" {
+				out.FinishReason = *choice.FinishReason
+			}
+			for i, tc := range choice.Delta.ToolCalls {
+				idx := i
+				if tc.Index != nil {
+					idx = *tc.Index
+				}
+				call, ok := calls[idx]
+				if !ok {
+					call = &ToolCall{}
+					calls[idx] = call
+				}
+				if tc.ID != "" {
+					call.ID = tc.ID
+				}
+				if tc.Function.Name != "" {
+					call.Name = tc.Function.Name
+				}
+				call.Arguments += tc.Function.Arguments
+			}
+			reasoning.WriteString(choice.Delta.ReasoningContent)
+			if choice.Delta.Content != nil && *choice.Delta.Content != "" {
+				content.WriteString(*choice.Delta.Content)
+				if onDelta != nil {
+					if err := onDelta(*choice.Delta.Content); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+	switch {
+	case err == nil:
+		// The body ended before [DONE], so the reply is cut off
+		return nil, io.ErrUnexpectedEOF
+	case !errors.Is(err, errStreamDone):
+		return nil, err
+	}
+
+	out.Content = content.String()
+	out.Reasoning = reasoning.String()
+	indexes := make([]int, 0, len(calls))
+	for idx := range calls {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+	for _, idx := range indexes {
+		out.ToolCalls = append(out.ToolCalls, *calls[idx])
+	}
+
+	return out, nil
+}
+
+func (p *OpenAIProvider) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	var body struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := getJSON(ctx, p.client, p.name, p.baseURL+"/models", p.headers(), &body); err != nil {
+		return nil, err
+	}
+
+	models := make([]ModelInfo, 0, len(body.Data))
+	for _, m := range body.Data {
+		models = append(models, ModelInfo{ID: m.ID, DisplayName: m.ID})
+	}
+	return models, nil
+}
+
+// requestID prefers the request ID header and falls back to the completion ID
+func requestID(resp *http.Response, fallback string) string {
+	for _, h := range []string{"X-Request-Id", "Request-Id"} {
+		if id := resp.Header.Get(h); id != "" {
+			return id
+		}
+	}
+	return fallback
+}
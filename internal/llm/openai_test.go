@@ -0,0 +1,168 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// sseData formats unnamed events, as OpenAI-compatible servers send them
+func sseData(chunks ...string) string {
+	var b strings.Builder
+	for _, chunk := range chunks {
+		b.WriteString("data: " + chunk + "\n\n")
+	}
+	return b.String()
+}
+
+func TestOpenAIStream(t *testing.T) {
+	server := newRecordedServer(t, http.StatusOK, sseData(
+		`{"id":"chatcmpl-1","model":"gpt-test","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"reasoning_content":"Two cities."},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"content":"Checking "},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"content":"both."},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_b","type":"function","function":{"name":"weather","arguments":""}}]},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"weather","arguments":"{\"city\":"}}]},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"function":{"arguments":"{\"city\":\"Lyon\"}"}}]},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`{"id":"chatcmpl-1","choices":[],"usage":{"prompt_tokens":20,"completion_tokens":7,"total_tokens":27}}`,
+		`[DONE]`,
+		// Anything after [DONE] is ignored
+		`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"content":" extra"},"finish_reason":"stop"}]}`,
+	))
+
+	p := NewOpenAIProvider("openai", server.URL, "sk-test")
+	var deltas []string
+	resp, err := p.Stream(context.Background(), Request{
+		Model:    "gpt-test",
+		Messages: []Message{{Role: RoleUser, Content: "Weather in Paris and Lyon?"}},
+	}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+
+	if got := strings.Join(deltas, "|"); got != "Checking |both." {
+		t.Errorf("deltas = %q", got)
+	}
+	if resp.Content != "Checking both." {
+		t.Errorf("Content = %q", resp.Content)
+	}
+	if resp.Reasoning != "Two cities." {
+		t.Errorf("Reasoning = %q", resp.Reasoning)
+	}
+	want := []ToolCall{
+		{ID: "call_a", Name: "weather", Arguments: `{"city":"Paris"}`},
+		{ID: "call_b", Name: "weather", Arguments: `{"city":"Lyon"}`},
+	}
+	if len(resp.ToolCalls) != len(want) {
+		t.Fatalf("ToolCalls = %+v, want %+v", resp.ToolCalls, want)
+	}
+	for i := range want {
+		if resp.ToolCalls[i] != want[i] {
+			t.Errorf("ToolCalls[%d] = %+v, want %+v", i, resp.ToolCalls[i], want[i])
+		}
+	}
+	if resp.Usage != (Usage{PromptTokens: 20, CompletionTokens: 7}) {
+		t.Errorf("Usage = %+v", resp.Usage)
+	}
+	if resp.FinishReason != FinishToolCalls {
+		t.Errorf("FinishReason = %q", resp.FinishReason)
+	}
+	if resp.RequestID != "chatcmpl-1" || resp.Model != "gpt-test" {
+		t.Errorf("RequestID, Model = %q, %q", resp.RequestID, resp.Model)
+	}
+	if got := server.header.Get("Authorization"); got != "Bearer sk-test" {
+		t.Errorf("Authorization = %q", got)
+	}
+	if !strings.Contains(string(server.body), `"include_usage":true`) {
+		t.Errorf("stream_options.include_usage not requested: %s", server.body)
+	}
+}
+
+func TestOpenAIStreamFinishReason(t *testing.T) {
+	tests := map[string]string{
+		"stop":           FinishStop,
+		"length":         FinishLength,
+		"tool_calls":     FinishToolCalls,
+		"content_filter": FinishContentFilter,
+	}
+	for reason, want := range tests {
+		server := newRecordedServer(t, http.StatusOK, sseData(
+			`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"content":"Hi"},"finish_reason":null}]}`,
+			`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{},"finish_reason":"`+reason+`"}]}`,
+			`[DONE]`,
+		))
+		p := NewOpenAIProvider("openai", server.URL, "sk-test")
+		resp, err := p.Stream(context.Background(), Request{Model: "gpt-test"}, nil)
+		if err != nil {
+			t.Fatalf("%s: Stream: %v", reason, err)
+		}
+		if resp.FinishReason != want {
+			t.Errorf("finish_reason %q gave %q, want %q", reason, resp.FinishReason, want)
+		}
+	}
+}
+
+// Without [DONE] the reply is cut off, even with a finish reason
+func TestOpenAIStreamCutOff(t *testing.T) {
+	server := newRecordedServer(t, http.StatusOK, sseData(
+		`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"content":"Hel"},"finish_reason":null}]}`,
+		`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+	))
+	p := NewOpenAIProvider("openai", server.URL, "sk-test")
+	var streamed string
+	_, err := p.Stream(context.Background(), Request{Model: "gpt-test"}, func(delta string) error {
+		streamed += delta
+		return nil
+	})
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("err = %v, want io.ErrUnexpectedEOF", err)
+	}
+	if streamed != "Hel" {
+		t.Errorf("streamed %q before the cut", streamed)
+	}
+}
+
+func TestOpenAIStreamAPIError(t *testing.T) {
+	server := newRecordedServer(t, http.StatusTooManyRequests,
+		`{"error":{"message":"Rate limit reached","type":"requests"}}`)
+
+	p := NewOpenAIProvider("openrouter", server.URL, "sk-test")
+	_, err := p.Stream(context.Background(), Request{Model: "gpt-test"}, nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want *APIError", err)
+	}
+	want := APIError{Provider: "openrouter", StatusCode: http.StatusTooManyRequests, Message: "Rate limit reached"}
+	if *apiErr != want {
+		t.Errorf("APIError = %+v, want %+v", *apiErr, want)
+	}
+}
+
+// Local servers such as llama.cpp run without a key and must not get an
+// empty bearer token
+func TestOpenAIStreamWithoutKey(t *testing.T) {
+	server := newRecordedServer(t, http.StatusOK, sseData(
+		`{"id":"1","choices":[{"index":0,"delta":{"content":"Hi"},"finish_reason":"stop"}]}`,
+		`[DONE]`,
+	))
+
+	p := NewOpenAIProvider("local", server.URL+"/", "")
+	resp, err := p.Stream(context.Background(), Request{Model: "local-model"}, nil)
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	if resp.Content != "Hi" {
+		t.Errorf("Content = %q", resp.Content)
+	}
+	if _, ok := server.header["Authorization"]; ok {
+		t.Errorf("Authorization header sent: %q", server.header.Get("Authorization"))
+	}
+}
@@ -0,0 +1,120 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Roles used in conversation history sent to a provider
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// Finish reasons stored with assistant messages. Providers map their own
+// stop reasons onto these.
+const (
+	FinishStop          = "stop"
+	FinishLength        = "length"
+	FinishToolCalls     = "tool_calls"
+	FinishContentFilter = "content_filter"
+	// Set by the app, not by providers, when a stream ends early
+	FinishInterrupted = "interrupted"
+	FinishError       = "error"
+)
+
+var ErrUnknownProvider = errors.New("unknown provider")
+
+// Provider is implemented by every model backend the chat can talk to
+type Provider interface {
+	Name() string
+	Complete(ctx context.Context, req Request) (*Response, error)
+	// Stream calls onDelta for every chunk of generated text and returns the
+	// final response once the model is done.
+	Stream(ctx context.Context, req Request, onDelta func(delta string) error) (*Response, error)
+	ListModels(ctx context.Context) ([]ModelInfo, error)
+}
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// Set on assistant messages that asked for tools to be run
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// Set on tool messages, pointing at the call they answer
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	// Images attached to a user message, only sent to vision models
+	Images []Image `json:"images,omitempty"`
+}
+
+type Image struct {
+	MimeType string `json:"mime_type"`
+	Data     []byte `json:"data"`
+}
+
+// Tool describes a function the model may call. Parameters is a JSON schema.
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type Request struct {
+	Model       string
+	System      string
+	Messages    []Message
+	Tools       []Tool
+	MaxTokens   int
+	Temperature *float64
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+type Response struct {
+	Model        string
+	Content      string
+	Reasoning    string // Thinking the model exposed, if any
+	FinishReason string
+	ToolCalls    []ToolCall
+	Usage        Usage
+	RequestID    string
+}
+
+// APIError is returned when a provider answers with a non-success status
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: %s (status %d)", e.Provider, e.Message, e.StatusCode)
+}
+
+type ModelInfo struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name"`
+}
+
+// BlockedError is returned when a provider refuses to answer because of its
+// safety filters. The message is readable enough to show to the user.
+type BlockedError struct {
+	Provider string
+	Reason   string
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("The response was blocked by %s safety filters (%s).", e.Provider, e.Reason)
+}
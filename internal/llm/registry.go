@@ -0,0 +1,119 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	discoveryTimeout = 3 * time.Second
+	discoveryTTL     = time.Minute
+)
+
+// Registry holds the configured providers, keyed by name
+type Registry struct {
+	mu        sync.RWMutex
+	providers map[string]Provider
+
+	discoverMu   sync.Mutex
+	discovered   []ProviderModels
+	discoveredAt time.Time
+}
+
+// ProviderModels is the outcome of asking one provider for its models
+type ProviderModels struct {
+	Provider  string
+	Models    []ModelInfo
+	Available bool
+	Err       error
+}
+
+func NewRegistry() *Registry {
+	return &Registry{providers: make(map[string]Provider)}
+}
+
+func (r *Registry) Register(p Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[p.Name()] = p
+
+	r.discoverMu.Lock()
+	r.discovered = nil
+	r.discoverMu.Unlock()
+}
+
+func (r *Registry) Get(name string) (Provider, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+	return p, nil
+}
+
+// Resolve splits a "provider/model" reference and returns the matching provider
+// together with the model name understood by that provider.
+func (r *Registry) Resolve(ref string) (Provider, string, error) {
+	name, model, ok := strings.Cut(ref, "/")
+	if !ok || name == "" || model == "" {
+		return nil, "", fmt.Errorf("invalid model reference %q", ref)
+	}
+	p, err := r.Get(name)
+	if err != nil {
+		return nil, "", err
+	}
+	return p, model, nil
+}
+
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Discover asks every provider for its models in parallel. A provider that
+// fails or times out is reported as unavailable instead of failing the call.
+// Results are cached for a minute so page loads stay fast.
+func (r *Registry) Discover(ctx context.Context) []ProviderModels {
+	r.discoverMu.Lock()
+	defer r.discoverMu.Unlock()
+	if r.discovered != nil && time.Since(r.discoveredAt) < discoveryTTL {
+		return r.discovered
+	}
+
+	names := r.Names()
+	results := make([]ProviderModels, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		p, _ := r.Get(name)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+			defer cancel()
+
+			models, err := p.ListModels(ctx)
+			results[i] = ProviderModels{
+				Provider:  name,
+				Models:    models,
+				Available: err == nil,
+				Err:       err,
+			}
+		}()
+	}
+	wg.Wait()
+
+	r.discovered = results
+	r.discoveredAt = time.Now()
+	return results
+}
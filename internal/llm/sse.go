@@ -0,0 +1,59 @@
+package llm
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+type sseEvent struct {
+	Event string
+	Data  string
+}
+
+// readSSE parses a text/event-stream body and calls fn for every event.
+// Comment lines and unknown fields are ignored.
+func readSSE(r io.Reader, fn func(sseEvent) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var ev sseEvent
+	var data []string
+	flush := func() error {
+		if len(data) == 0 {
+			ev = sseEvent{}
+			return nil
+		}
+		ev.Data = strings.Join(data, "\n")
+		err := fn(ev)
+		ev = sseEvent{}
+		data = data[:0]
+		return err
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if err := flush(); err != nil {
+				return err
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			ev.Event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
@@ -0,0 +1,125 @@
+// Package markdown renders model output to sanitized HTML.
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// Raw HTML in the source is dropped by goldmark already. The sanitizer is
+// the second line of defence and only lets through what the renderer and
+// highlighter produce.
+var (
+	md = goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+		goldmark.WithRendererOptions(
+			renderer.WithNodeRenderers(util.Prioritized(&codeBlockRenderer{}, 100)),
+		),
+	)
+	policy    = newPolicy()
+	formatter = chromahtml.New(chromahtml.WithClasses(true), chromahtml.PreventSurroundingPre(false))
+)
+
+var className = regexp.MustCompile(`^[a-zA-Z0-9 _-]+$`)
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements("p", "br", "hr", "h1", "h2", "h3", "h4", "h5", "h6",
+		"strong", "em", "del", "code", "pre", "blockquote", "ul", "ol", "li",
+		"table", "thead", "tbody", "tr", "th", "td", "div", "span")
+
+	// Links only to http(s), mailto and relative URLs, opened safely
+	p.AllowStandardURLs()
+	p.AllowAttrs("href").OnElements("a")
+	p.RequireNoFollowOnLinks(true)
+	p.RequireNoReferrerOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+
+	p.AllowAttrs("class").Matching(className).OnElements("div", "span", "pre", "code")
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|center|right)$`)).OnElements("th", "td")
+	p.AllowAttrs("style").Matching(regexp.MustCompile(`^text-align:\s*(left|center|right);?$`)).OnElements("th", "td")
+
+	// GFM task lists
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	return p
+}
+
+// Render converts Markdown to sanitized HTML. Unterminated constructs, as
+// seen while a reply is still streaming, render as far as they go.
+func Render(source string) string {
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(source), &buf); err != nil {
+		// Fall back to the escaped source rather than showing nothing
+		return "<p>" + bluemonday.StrictPolicy().Sanitize(source) + "</p>"
+	}
+	return policy.Sanitize(buf.String())
+}
+
+// codeBlockRenderer highlights fenced code blocks and labels them with
+// their language
+type codeBlockRenderer struct{}
+
+func (r *codeBlockRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, r.render)
+}
+
+func (r *codeBlockRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	block := node.(*ast.FencedCodeBlock)
+
+	var code strings.Builder
+	lines := block.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		code.Write(line.Value(source))
+	}
+
+	language := ""
+	if block.Info != nil {
+		language = string(block.Language(source))
+	}
+
+	lexer := lexers.Get(language)
+	if lexer == nil {
+		lexer = lexers.Analyse(code.String())
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	w.WriteString(`<div class="code-block">`)
+	if language != "" {
+		w.WriteString(`<div class="code-language">`)
+		w.Write(util.EscapeHTML([]byte(language)))
+		w.WriteString(`</div>`)
+	}
+
+	iterator, err := lexer.Tokenise(nil, code.String())
+	if err == nil {
+		err = formatter.Format(w, highlightStyle, iterator)
+	}
+	if err != nil {
+		w.WriteString(`<pre><code>`)
+		w.Write(util.EscapeHTML([]byte(code.String())))
+		w.WriteString(`</code></pre>`)
+	}
+	w.WriteString("</div>\n")
+
+	return ast.WalkSkipChildren, nil
+}
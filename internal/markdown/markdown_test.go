@@ -0,0 +1,110 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := map[string]struct {
+		source  string
+		want    []string
+		notWant []string
+	}{
+		"javascript link": {
+			source:  "[click](javascript:alert(1))",
+			want:    []string{"click"},
+			notWant: []string{"href", "javascript"},
+		},
+		"data link": {
+			source:  "[click](data:text/html;base64,PHNjcmlwdD4=)",
+			want:    []string{"click"},
+			notWant: []string{"href", "data:"},
+		},
+		"javascript image": {
+			source:  "![pic](javascript:alert(1))",
+			notWant: []string{"<img", "javascript"},
+		},
+		"script": {
+			source:  "<script>alert(1)</script>",
+			notWant: []string{"<script", "alert"},
+		},
+		"img onerror": {
+			source:  `<img src=x onerror="alert(1)">`,
+			notWant: []string{"<img", "onerror"},
+		},
+		"iframe": {
+			source:  `<iframe src="https://example.com"></iframe>`,
+			notWant: []string{"<iframe", "example.com"},
+		},
+		"inline event handler": {
+			source:  `hello <a href="https://example.com" onclick="alert(1)">there</a>`,
+			want:    []string{"hello", "there"},
+			notWant: []string{"onclick", "alert"},
+		},
+		"code info attribute": {
+			source:  "```go\" onmouseover=\"alert(1)\nx := 1\n```",
+			notWant: []string{`" onmouseover`, "onmouseover="},
+		},
+		"code info tag": {
+			source:  "```\"><script>alert(1)</script>\nx\n```",
+			notWant: []string{"<script"},
+		},
+		"ordinary markdown": {
+			source: "# Title\n\nSome **bold**, *em* and [a link](https://go.dev).\n\n- [x] done\n\n| a | b |\n|---|--:|\n| 1 | 2 |",
+			want: []string{
+				"<h1>Title</h1>",
+				"<strong>bold</strong>",
+				"<em>em</em>",
+				`<a href="https://go.dev" rel="nofollow noreferrer noopener" target="_blank">a link</a>`,
+				`<input checked="" disabled="" type="checkbox">`,
+				"<table>",
+				`<td style="text-align:right">2</td>`,
+			},
+		},
+		"highlighted code": {
+			source: "```go\nfunc main() {}\n```",
+			want: []string{
+				`<div class="code-language">go</div>`,
+				`<pre class="chroma">`,
+				`<span class="kd">func</span>`,
+			},
+		},
+		"unterminated code": {
+			source: "```python\nprint(1)",
+			want:   []string{`<div class="code-language">python</div>`, "print"},
+		},
+	}
+	for name, tt := range tests {
+		got := Render(tt.source)
+		for _, s := range tt.want {
+			if !strings.Contains(got, s) {
+				t.Errorf("%s: Render = %q, want it to contain %q", name, got, s)
+			}
+		}
+		for _, s := range tt.notWant {
+			if strings.Contains(got, s) {
+				t.Errorf("%s: Render = %q, must not contain %q", name, got, s)
+			}
+		}
+	}
+}
+
+// The policy also holds if raw HTML ever gets past the renderer
+func TestPolicy(t *testing.T) {
+	tests := map[string]string{
+		`<a href="javascript:alert(1)">x</a>`:                     "x",
+		`<a href="data:text/html,hi">x</a>`:                       "x",
+		`<script>alert(1)</script>`:                               "",
+		`<img src="x" onerror="alert(1)">`:                        "",
+		`<iframe src="https://example.com"></iframe>`:             "",
+		`<div class="code-block" onclick="alert(1)">x</div>`:      `<div class="code-block">x</div>`,
+		`<span class="a&#34; onmouseover=&#34;alert(1)">x</span>`: "<span>x</span>",
+		`<td style="background:url(javascript:x)">x</td>`:         "<td>x</td>",
+	}
+	for html, want := range tests {
+		if got := policy.Sanitize(html); got != want {
+			t.Errorf("Sanitize(%q) = %q, want %q", html, got, want)
+		}
+	}
+}
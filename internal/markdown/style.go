@@ -0,0 +1,14 @@
+package markdown
+
+import (
+	"io"
+
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+var highlightStyle = styles.Get("github")
+
+// WriteCSS writes the stylesheet for the highlighted code classes
+func WriteCSS(w io.Writer) error {
+	return formatter.WriteCSS(w, highlightStyle)
+}
@@ -2,24 +2,132 @@ package models
 
 import (
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strings"
 	"time"
 )
 
 type MessageTree struct {
-	ID        int       `json:"id" db:"id"`
-	UserID    int       `json:"user_id" db:"user_id"`
-	AIID      *int      `json:"ai_id" db:"ai_id"`
-	Title     string    `json:"title" db:"title"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID           int       `json:"id" db:"id"`
+	UserID       int       `json:"user_id" db:"user_id"`
+	AIID         *int      `json:"ai_id" db:"ai_id"`
+	Title        string    `json:"title" db:"title"`
+	ActiveLeafID *int      `json:"active_leaf_id" db:"active_leaf_id"` // Last message of the branch being shown
+	Pinned       bool      `json:"pinned" db:"pinned"`
+	Archived     bool      `json:"archived" db:"archived"`
+	ForkedFromID *int      `json:"forked_from_id" db:"forked_from_id"` // Source of a tree continued from a share link
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 }
 
 type Message struct {
-	ID            int       `json:"id" db:"id"`
-	MessageTreeID int       `json:"message_tree_id" db:"message_tree_id"`
-	Content       string    `json:"content" db:"content"`
-	IsIncoming    bool      `json:"is_incoming" db:"is_incoming"`
-	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	ID              int        `json:"id" db:"id"`
+	MessageTreeID   int        `json:"message_tree_id" db:"message_tree_id"`
+	ParentMessageID *int       `json:"parent_message_id" db:"parent_message_id"` // nil for the first message
+	Role            string     `json:"role" db:"role"`
+	Content         string     `json:"content" db:"content"` // Plain text of the text parts
+	Parts           Parts      `json:"parts" db:"parts"`
+	ModelID         *int       `json:"model_id" db:"model_id"`
+	ModelName       string     `json:"model_name,omitempty" db:"-"` // Display name of ModelID
+	Generation      Generation `json:"generation"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+
+	// Position among messages sharing the same parent, 1-based. Only set
+	// by GetActivePath.
+	SiblingIndex int `json:"sibling_index,omitempty" db:"-"`
+	SiblingCount int `json:"sibling_count,omitempty" db:"-"`
+}
+
+// Generation records how an assistant message was produced. All fields are
+// zero for other messages.
+type Generation struct {
+	PromptTokens       int    `json:"prompt_tokens,omitempty" db:"prompt_tokens"`
+	CompletionTokens   int    `json:"completion_tokens,omitempty" db:"completion_tokens"`
+	TimeToFirstTokenMs int    `json:"time_to_first_token_ms,omitempty" db:"time_to_first_token_ms"`
+	DurationMs         int    `json:"duration_ms,omitempty" db:"duration_ms"`
+	FinishReason       string `json:"finish_reason,omitempty" db:"finish_reason"`
+	ProviderRequestID  string `json:"provider_request_id,omitempty" db:"provider_request_id"`
+}
+
+func (g Generation) IsZero() bool {
+	return g == Generation{}
+}
+
+// Message roles
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// Content part types
+const (
+	PartText       = "text"
+	PartImage      = "image"
+	PartToolCall   = "tool_call"
+	PartToolResult = "tool_result"
+	PartReasoning  = "reasoning"
+	PartCitation   = "citation"
+)
+
+// ContentPart is one piece of a message. Which fields are set depends on Type.
+type ContentPart struct {
+	Type string `json:"type"`
+	// text, reasoning, tool_result and citation (the quoted chunk)
+	Text string `json:"text,omitempty"`
+	// image: reference to the stored blob and its thumbnail
+	ImageRef     string `json:"image_ref,omitempty"`
+	ThumbnailRef string `json:"thumbnail_ref,omitempty"`
+	MimeType     string `json:"mime_type,omitempty"`
+	// tool_call and tool_result
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	ToolName   string `json:"tool_name,omitempty"`
+	Arguments  string `json:"arguments,omitempty"`
+	// citation: the document chunk the reply drew on
+	ChunkID int    `json:"chunk_id,omitempty"`
+	Source  string `json:"source,omitempty"`
+	Label   int    `json:"label,omitempty"` // The [n] the prompt numbered it with
+}
+
+// Parts is stored as a JSONB array
+type Parts []ContentPart
+
+func (p Parts) Value() (driver.Value, error) {
+	if p == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(p)
+}
+
+func (p *Parts) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, p)
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	case nil:
+		*p = nil
+		return nil
+	}
+	return errors.New("unsupported type for message parts")
+}
+
+// Text joins the text parts
+func (p Parts) Text() string {
+	var texts []string
+	for _, part := range p {
+		if part.Type == PartText {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+func (m Message) IsFromUser() bool {
+	return m.Role == RoleUser
 }
 
 type ChatService struct {
@@ -30,15 +138,70 @@ func NewChatService(db *sql.DB) *ChatService {
 	return &ChatService{db: db}
 }
 
-func (s *ChatService) GetUserMessageTrees(userID int) ([]MessageTree, error) {
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+const treeColumns = `id, user_id, ai_id, title, active_leaf_id, pinned, archived, forked_from_id, created_at, updated_at`
+
+func scanTree(row rowScanner) (*MessageTree, error) {
+	tree := &MessageTree{}
+	err := row.Scan(&tree.ID, &tree.UserID, &tree.AIID, &tree.Title,
+		&tree.ActiveLeafID, &tree.Pinned, &tree.Archived, &tree.ForkedFromID, &tree.CreatedAt, &tree.UpdatedAt)
+	return tree, err
+}
+
+// messageColumns expects messages aliased as m and models joined as md
+const messageColumns = `
+        m.id, m.message_tree_id, m.parent_message_id, m.role, m.content, m.parts,
+        m.model_id, COALESCE(md.display_name, ''),
+        COALESCE(m.prompt_tokens, 0), COALESCE(m.completion_tokens, 0),
+        COALESCE(m.time_to_first_token_ms, 0), COALESCE(m.duration_ms, 0),
+        COALESCE(m.finish_reason, ''), COALESCE(m.provider_request_id, ''),
+        m.created_at
+    `
+
+// scanMessage scans messageColumns followed by any extra columns
+func scanMessage(row rowScanner, extra ...any) (*Message, error) {
+	msg := &Message{}
+	g := &msg.Generation
+	dest := []any{&msg.ID, &msg.MessageTreeID, &msg.ParentMessageID, &msg.Role,
+		&msg.Content, &msg.Parts, &msg.ModelID, &msg.ModelName,
+		&g.PromptTokens, &g.CompletionTokens, &g.TimeToFirstTokenMs, &g.DurationMs,
+		&g.FinishReason, &g.ProviderRequestID, &msg.CreatedAt}
+	err := row.Scan(append(dest, extra...)...)
+	return msg, err
+}
+
+func scanMessages(rows *sql.Rows) ([]Message, error) {
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// GetUserMessageTrees lists a user's trees, pinned ones first. Archived
+// trees are only included when asked for.
+func (s *ChatService) GetUserMessageTrees(userID int, includeArchived bool) ([]MessageTree, error) {
 	query := `
-        SELECT id, user_id, ai_id, title, created_at, updated_at
-        FROM message_trees 
-        WHERE user_id = $1 
-        ORDER BY updated_at DESC
+        SELECT ` + treeColumns + `
+        FROM message_trees
+        WHERE user_id = $1 AND (NOT archived OR $2)
+        ORDER BY pinned DESC, updated_at DESC
     `
 
-	rows, err := s.db.Query(query, userID)
+	rows, err := s.db.Query(query, userID, includeArchived)
 	if err != nil {
 		return nil, err
 	}
@@ -46,42 +209,169 @@ func (s *ChatService) GetUserMessageTrees(userID int) ([]MessageTree, error) {
 
 	var trees []MessageTree
 	for rows.Next() {
-		var tree MessageTree
-		err := rows.Scan(&tree.ID, &tree.UserID, &tree.AIID, &tree.Title,
-			&tree.CreatedAt, &tree.UpdatedAt)
+		tree, err := scanTree(rows)
 		if err != nil {
 			return nil, err
 		}
-		trees = append(trees, tree)
+		trees = append(trees, *tree)
 	}
 
 	return trees, nil
 }
 
-func (s *ChatService) CreateMessageTree(userID int) (*MessageTree, error) {
+// TreeCursor marks the last tree of a page from GetUserMessageTreesPage
+type TreeCursor struct {
+	UpdatedAt time.Time
+	ID        int
+}
+
+// GetUserMessageTreesPage lists up to limit of a user's trees, most
+// recently updated first, starting after the cursor when there is one.
+// Unlike GetUserMessageTrees pinned trees are not listed first, which keeps
+// the order stable for paging.
+func (s *ChatService) GetUserMessageTreesPage(userID int, includeArchived bool, after *TreeCursor, limit int) ([]MessageTree, error) {
+	query := `
+        SELECT ` + treeColumns + `
+        FROM message_trees
+        WHERE user_id = $1 AND (NOT archived OR $2)
+          AND ($3::timestamptz IS NULL OR (updated_at, id) < ($3, $4))
+        ORDER BY updated_at DESC, id DESC
+        LIMIT $5
+    `
+
+	var afterTime *time.Time
+	var afterID int
+	if after != nil {
+		afterTime, afterID = &after.UpdatedAt, after.ID
+	}
+	rows, err := s.db.Query(query, userID, includeArchived, afterTime, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trees []MessageTree
+	for rows.Next() {
+		tree, err := scanTree(rows)
+		if err != nil {
+			return nil, err
+		}
+		trees = append(trees, *tree)
+	}
+
+	return trees, rows.Err()
+}
+
+func (s *ChatService) CreateMessageTree(userID int, aiID *int) (*MessageTree, error) {
+	return createMessageTree(s.db, userID, aiID)
+}
+
+func createMessageTree(q querier, userID int, aiID *int) (*MessageTree, error) {
 	tree := &MessageTree{
 		UserID: userID,
-		Title:  "New Chat",
+		AIID:   aiID,
+		Title:  DefaultTitle,
 	}
 
 	query := `
-        INSERT INTO message_trees (user_id, title)
-        VALUES ($1, $2)
+        INSERT INTO message_trees (user_id, ai_id, title)
+        VALUES ($1, $2, $3)
         RETURNING id, created_at, updated_at
     `
 
-	err := s.db.QueryRow(query, tree.UserID, tree.Title).
+	err := q.QueryRow(query, tree.UserID, tree.AIID, tree.Title).
 		Scan(&tree.ID, &tree.CreatedAt, &tree.UpdatedAt)
 
 	return tree, err
 }
 
+// DefaultTitle is what a tree is called until it gets a generated title
+const DefaultTitle = "New Chat"
+
+func (s *ChatService) UpdateTitle(treeID int, title string) error {
+	_, err := s.db.Exec("UPDATE message_trees SET title = $1 WHERE id = $2", title, treeID)
+	return err
+}
+
+// SetTreeModel switches the model used for future replies in a tree
+func (s *ChatService) SetTreeModel(treeID, userID, aiID int) error {
+	result, err := s.db.Exec(`
+        UPDATE message_trees SET ai_id = $1, updated_at = NOW()
+        WHERE id = $2 AND user_id = $3
+    `, aiID, treeID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetMessagesByTreeID returns every message of a tree across all branches
 func (s *ChatService) GetMessagesByTreeID(treeID int) ([]Message, error) {
 	query := `
-        SELECT id, message_tree_id, content, is_incoming, created_at
-        FROM messages 
-        WHERE message_tree_id = $1 
-        ORDER BY created_at ASC
+        SELECT ` + messageColumns + `
+        FROM messages m
+        LEFT JOIN models md ON md.id = m.model_id
+        WHERE m.message_tree_id = $1
+        ORDER BY m.created_at ASC, m.id ASC
+    `
+
+	rows, err := s.db.Query(query, treeID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMessages(rows)
+}
+
+// GetMessagesPage returns up to limit messages of a tree across all
+// branches in the order they were written, starting after afterID.
+func (s *ChatService) GetMessagesPage(treeID, afterID, limit int) ([]Message, error) {
+	query := `
+        SELECT ` + messageColumns + `
+        FROM messages m
+        LEFT JOIN models md ON md.id = m.model_id
+        WHERE m.message_tree_id = $1 AND m.id > $2
+        ORDER BY m.id ASC
+        LIMIT $3
+    `
+
+	rows, err := s.db.Query(query, treeID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMessages(rows)
+}
+
+// GetActivePath returns the branch ending at the tree's active leaf, from
+// the first message down to the leaf, with sibling positions filled in.
+func (s *ChatService) GetActivePath(treeID int) ([]Message, error) {
+	query := `
+        WITH RECURSIVE path AS (
+            SELECT msg.*, 0 AS depth
+            FROM messages msg
+            JOIN message_trees t ON t.active_leaf_id = msg.id
+            WHERE t.id = $1
+            UNION ALL
+            SELECT msg.*, path.depth + 1
+            FROM messages msg
+            JOIN path ON msg.id = path.parent_message_id
+        )
+        SELECT ` + messageColumns + `,
+               sib.position, sib.total
+        FROM path m
+        LEFT JOIN models md ON md.id = m.model_id
+        CROSS JOIN LATERAL (
+            SELECT COUNT(*) FILTER (WHERE (s.created_at, s.id) <= (m.created_at, m.id)) AS position,
+                   COUNT(*) AS total
+            FROM messages s
+            WHERE s.message_tree_id = m.message_tree_id
+              AND s.parent_message_id IS NOT DISTINCT FROM m.parent_message_id
+        ) sib
+        ORDER BY m.depth DESC
     `
 
 	rows, err := s.db.Query(query, treeID)
@@ -92,53 +382,161 @@ func (s *ChatService) GetMessagesByTreeID(treeID int) ([]Message, error) {
 
 	var messages []Message
 	for rows.Next() {
-		var msg Message
-		err := rows.Scan(&msg.ID, &msg.MessageTreeID, &msg.Content,
-			&msg.IsIncoming, &msg.CreatedAt)
+		var position, total int
+		msg, err := scanMessage(rows, &position, &total)
 		if err != nil {
 			return nil, err
 		}
-		messages = append(messages, msg)
+		msg.SiblingIndex, msg.SiblingCount = position, total
+		messages = append(messages, *msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// GetChildren returns the replies to a message, oldest first. More than one
+// child means the conversation branches there.
+func (s *ChatService) GetChildren(messageID int) ([]Message, error) {
+	query := `
+        SELECT ` + messageColumns + `
+        FROM messages m
+        LEFT JOIN models md ON md.id = m.model_id
+        WHERE m.parent_message_id = $1
+        ORDER BY m.created_at ASC, m.id ASC
+    `
+
+	rows, err := s.db.Query(query, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMessages(rows)
+}
+
+// GetSiblings returns the messages sharing msg's parent, msg included,
+// oldest first.
+func (s *ChatService) GetSiblings(msg *Message) ([]Message, error) {
+	query := `
+        SELECT ` + messageColumns + `
+        FROM messages m
+        LEFT JOIN models md ON md.id = m.model_id
+        WHERE m.message_tree_id = $1
+          AND m.parent_message_id IS NOT DISTINCT FROM $2
+        ORDER BY m.created_at ASC, m.id ASC
+    `
+
+	rows, err := s.db.Query(query, msg.MessageTreeID, msg.ParentMessageID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMessages(rows)
+}
+
+// LatestLeaf follows the newest reply at every level below messageID and
+// returns the leaf it ends at.
+func (s *ChatService) LatestLeaf(messageID int) (int, error) {
+	for {
+		children, err := s.GetChildren(messageID)
+		if err != nil {
+			return 0, err
+		}
+		if len(children) == 0 {
+			return messageID, nil
+		}
+		messageID = children[len(children)-1].ID
 	}
+}
 
-	return messages, nil
+// SetActiveLeaf makes the branch ending at messageID the one shown
+func (s *ChatService) SetActiveLeaf(treeID, messageID int) error {
+	result, err := s.db.Exec(`
+        UPDATE message_trees SET active_leaf_id = $1, updated_at = NOW()
+        WHERE id = $2
+          AND EXISTS (SELECT 1 FROM messages WHERE id = $1 AND message_tree_id = $2)
+    `, messageID, treeID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
 func (s *ChatService) GetMessageTree(treeID, userID int) (*MessageTree, error) {
-	tree := &MessageTree{}
 	query := `
-        SELECT id, user_id, ai_id, title, created_at, updated_at
-        FROM message_trees 
+        SELECT ` + treeColumns + `
+        FROM message_trees
         WHERE id = $1 AND user_id = $2
     `
 
-	err := s.db.QueryRow(query, treeID, userID).Scan(
-		&tree.ID, &tree.UserID, &tree.AIID, &tree.Title,
-		&tree.CreatedAt, &tree.UpdatedAt)
+	return scanTree(s.db.QueryRow(query, treeID, userID))
+}
 
-	return tree, err
+func (s *ChatService) GetMessage(messageID, treeID int) (*Message, error) {
+	query := `
+        SELECT ` + messageColumns + `
+        FROM messages m
+        LEFT JOIN models md ON md.id = m.model_id
+        WHERE m.id = $1 AND m.message_tree_id = $2
+    `
+
+	return scanMessage(s.db.QueryRow(query, messageID, treeID))
 }
 
-func (s *ChatService) SaveMessage(treeID int, content string, isIncoming bool) (*Message, error) {
-	msg := &Message{
-		MessageTreeID: treeID,
-		Content:       content,
-		IsIncoming:    isIncoming,
+// SaveMessage stores msg under msg.ParentMessageID and makes it the active
+// leaf of its tree. A message with only Content gets a single text part, and
+// Content is always rewritten from the text parts. ID and CreatedAt are
+// filled in on success.
+func (s *ChatService) SaveMessage(msg *Message) error {
+	if msg.Role == "" {
+		msg.Role = RoleUser
 	}
+	if len(msg.Parts) == 0 && msg.Content != "" {
+		msg.Parts = Parts{{Type: PartText, Text: msg.Content}}
+	}
+	msg.Content = msg.Parts.Text()
 
 	query := `
-        INSERT INTO messages (message_tree_id, content, is_incoming)
-        VALUES ($1, $2, $3)
+        INSERT INTO messages (message_tree_id, parent_message_id, role, content, parts, model_id,
+            prompt_tokens, completion_tokens, time_to_first_token_ms, duration_ms,
+            finish_reason, provider_request_id)
+        VALUES ($1, $2, $3, $4, $5, $6,
+            NULLIF($7, 0), NULLIF($8, 0), NULLIF($9, 0), NULLIF($10, 0),
+            NULLIF($11, ''), NULLIF($12, ''))
         RETURNING id, created_at
     `
 
-	err := s.db.QueryRow(query, msg.MessageTreeID, msg.Content, msg.IsIncoming).
+	g := msg.Generation
+	err := s.db.QueryRow(query, msg.MessageTreeID, msg.ParentMessageID, msg.Role,
+		msg.Content, msg.Parts, msg.ModelID,
+		g.PromptTokens, g.CompletionTokens, g.TimeToFirstTokenMs, g.DurationMs,
+		g.FinishReason, g.ProviderRequestID).
 		Scan(&msg.ID, &msg.CreatedAt)
 
-	// Update the message tree's updated_at timestamp
+	// Update the message tree's updated_at timestamp and active branch
 	if err == nil {
-		s.db.Exec("UPDATE message_trees SET updated_at = NOW() WHERE id = $1", treeID)
+		s.db.Exec("UPDATE message_trees SET updated_at = NOW(), active_leaf_id = $2 WHERE id = $1",
+			msg.MessageTreeID, msg.ID)
 	}
 
-	return msg, err
+	return err
+}
+
+// TreeHasBlob reports whether a message in the tree refers to the blob,
+// either as an image or as its thumbnail
+func (s *ChatService) TreeHasBlob(treeID int, key string) (bool, error) {
+	query := `
+        SELECT EXISTS (
+            SELECT 1 FROM messages
+            WHERE message_tree_id = $1
+              AND (parts @> jsonb_build_array(jsonb_build_object('image_ref', $2::text))
+                OR parts @> jsonb_build_array(jsonb_build_object('thumbnail_ref', $2::text)))
+        )
+    `
+
+	var exists bool
+	err := s.db.QueryRow(query, treeID, key).Scan(&exists)
+	return exists, err
 }
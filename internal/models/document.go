@@ -0,0 +1,159 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Document is a file attached to a tree. Its text is stored as embedded
+// chunks, the file itself is not kept.
+type Document struct {
+	ID            int       `json:"id" db:"id"`
+	MessageTreeID int       `json:"message_tree_id" db:"message_tree_id"`
+	Filename      string    `json:"filename" db:"filename"`
+	MimeType      string    `json:"mime_type" db:"mime_type"`
+	SizeBytes     int       `json:"size_bytes" db:"size_bytes"`
+	ChunkCount    int       `json:"chunk_count" db:"-"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+// DocumentChunk is a piece of a document retrieved for a question
+type DocumentChunk struct {
+	ID         int     `json:"id" db:"id"`
+	DocumentID int     `json:"document_id" db:"document_id"`
+	Filename   string  `json:"filename" db:"-"`
+	ChunkIndex int     `json:"chunk_index" db:"chunk_index"`
+	Content    string  `json:"content" db:"content"`
+	Similarity float64 `json:"similarity" db:"-"`
+}
+
+type DocumentService struct {
+	db *sql.DB
+}
+
+func NewDocumentService(db *sql.DB) *DocumentService {
+	return &DocumentService{db: db}
+}
+
+// CreateDocument stores a document with its chunks and their embeddings in
+// one transaction, so a failed upload leaves nothing half indexed.
+func (s *DocumentService) CreateDocument(doc *Document, chunks []string, embedder string, embeddings [][]float32) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+        INSERT INTO documents (message_tree_id, filename, mime_type, size_bytes)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, created_at
+    `
+	err = tx.QueryRow(query, doc.MessageTreeID, doc.Filename, doc.MimeType, doc.SizeBytes).
+		Scan(&doc.ID, &doc.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	for i, chunk := range chunks {
+		_, err := tx.Exec(`
+            INSERT INTO document_chunks (document_id, chunk_index, content, embedder, embedding)
+            VALUES ($1, $2, $3, $4, $5::vector)
+        `, doc.ID, i, chunk, embedder, vectorLiteral(embeddings[i]))
+		if err != nil {
+			return err
+		}
+	}
+	doc.ChunkCount = len(chunks)
+
+	return tx.Commit()
+}
+
+func (s *DocumentService) GetTreeDocuments(treeID int) ([]Document, error) {
+	query := `
+        SELECT d.id, d.message_tree_id, d.filename, d.mime_type, d.size_bytes,
+            (SELECT COUNT(*) FROM document_chunks c WHERE c.document_id = d.id), d.created_at
+        FROM documents d
+        WHERE d.message_tree_id = $1
+        ORDER BY d.created_at
+    `
+
+	rows, err := s.db.Query(query, treeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var docs []Document
+	for rows.Next() {
+		var d Document
+		err := rows.Scan(&d.ID, &d.MessageTreeID, &d.Filename, &d.MimeType, &d.SizeBytes,
+			&d.ChunkCount, &d.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, d)
+	}
+
+	return docs, rows.Err()
+}
+
+func (s *DocumentService) DeleteDocument(documentID, treeID int) error {
+	result, err := s.db.Exec("DELETE FROM documents WHERE id = $1 AND message_tree_id = $2", documentID, treeID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// HasChunks reports whether the tree has any chunks embedded with the
+// embedder, so questions need not be embedded when there is nothing to
+// search
+func (s *DocumentService) HasChunks(treeID int, embedder string) (bool, error) {
+	query := `
+        SELECT EXISTS (
+            SELECT 1 FROM document_chunks c
+            JOIN documents d ON d.id = c.document_id
+            WHERE d.message_tree_id = $1 AND c.embedder = $2
+        )
+    `
+
+	var exists bool
+	err := s.db.QueryRow(query, treeID, embedder).Scan(&exists)
+	return exists, err
+}
+
+// SearchChunks returns the tree's chunks closest to the query vector, most
+// similar first. Chunks embedded with another embedder are skipped.
+func (s *DocumentService) SearchChunks(treeID int, embedder string, embedding []float32, limit int) ([]DocumentChunk, error) {
+	query := `
+        SELECT c.id, c.document_id, d.filename, c.chunk_index, c.content,
+            1 - (c.embedding <=> $3::vector)
+        FROM document_chunks c
+        JOIN documents d ON d.id = c.document_id
+        WHERE d.message_tree_id = $1 AND c.embedder = $2
+        ORDER BY c.embedding <=> $3::vector
+        LIMIT $4
+    `
+
+	rows, err := s.db.Query(query, treeID, embedder, vectorLiteral(embedding), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chunks []DocumentChunk
+	for rows.Next() {
+		var c DocumentChunk
+		err := rows.Scan(&c.ID, &c.DocumentID, &c.Filename, &c.ChunkIndex, &c.Content, &c.Similarity)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, c)
+	}
+
+	return chunks, rows.Err()
+}
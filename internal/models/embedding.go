@@ -0,0 +1,154 @@
+package models
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+const snippetLength = 200
+
+// PendingEmbedding is a message that has no embedding yet
+type PendingEmbedding struct {
+	MessageID int
+	Content   string
+}
+
+type EmbeddingService struct {
+	db *sql.DB
+}
+
+func NewEmbeddingService(db *sql.DB) *EmbeddingService {
+	return &EmbeddingService{db: db}
+}
+
+// Failed messages are retried after failureBackoff, at most
+// maxEmbeddingAttempts times in all
+const (
+	maxEmbeddingAttempts = 5
+	failureBackoff       = "1 hour"
+)
+
+// PendingMessages returns up to limit user and assistant messages with text
+// that the embedder has not indexed yet, oldest first. Messages it recently
+// failed on, or failed on too often, are left out.
+func (s *EmbeddingService) PendingMessages(embedder string, limit int) ([]PendingEmbedding, error) {
+	query := `
+        SELECT m.id, m.content
+        FROM messages m
+        WHERE m.role IN ('user', 'assistant')
+          AND m.content <> ''
+          AND NOT EXISTS (
+              SELECT 1 FROM message_embeddings e
+              WHERE e.message_id = m.id AND e.embedder = $1
+          )
+          AND NOT EXISTS (
+              SELECT 1 FROM message_embedding_failures f
+              WHERE f.message_id = m.id AND f.embedder = $1
+                AND (f.attempts >= $3 OR f.failed_at > NOW() - $4::interval)
+          )
+        ORDER BY m.id
+        LIMIT $2
+    `
+
+	rows, err := s.db.Query(query, embedder, limit, maxEmbeddingAttempts, failureBackoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pending []PendingEmbedding
+	for rows.Next() {
+		var p PendingEmbedding
+		if err := rows.Scan(&p.MessageID, &p.Content); err != nil {
+			return nil, err
+		}
+		pending = append(pending, p)
+	}
+
+	return pending, rows.Err()
+}
+
+func (s *EmbeddingService) SaveEmbedding(messageID int, embedder string, embedding []float32) error {
+	query := `
+        INSERT INTO message_embeddings (message_id, embedder, embedding)
+        VALUES ($1, $2, $3::vector)
+        ON CONFLICT (message_id, embedder) DO UPDATE SET embedding = EXCLUDED.embedding
+    `
+
+	_, err := s.db.Exec(query, messageID, embedder, vectorLiteral(embedding))
+	return err
+}
+
+// RecordFailure notes that the embedder could not embed a message
+func (s *EmbeddingService) RecordFailure(messageID int, embedder string, cause error) error {
+	query := `
+        INSERT INTO message_embedding_failures (message_id, embedder, last_error)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (message_id, embedder) DO UPDATE SET
+            attempts = message_embedding_failures.attempts + 1,
+            last_error = EXCLUDED.last_error,
+            failed_at = NOW()
+    `
+
+	_, err := s.db.Exec(query, messageID, embedder, cause.Error())
+	return err
+}
+
+// SimilarMessages returns the user's messages closest to the query vector,
+// most similar first. Rank is the cosine similarity.
+func (s *EmbeddingService) SimilarMessages(userID int, embedder string, embedding []float32, limit int) ([]SearchResult, error) {
+	query := `
+        SELECT t.id, t.title, m.id, m.role, m.content,
+            1 - (e.embedding <=> $3::vector) AS similarity, m.created_at
+        FROM message_embeddings e
+        JOIN messages m ON m.id = e.message_id
+        JOIN message_trees t ON t.id = m.message_tree_id
+        WHERE t.user_id = $1 AND e.embedder = $2
+        ORDER BY e.embedding <=> $3::vector
+        LIMIT $4
+    `
+
+	rows, err := s.db.Query(query, userID, embedder, vectorLiteral(embedding), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		var content string
+		err := rows.Scan(&r.TreeID, &r.TreeTitle, &r.MessageID, &r.Role,
+			&content, &r.Rank, &r.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		r.Snippet = []Highlight{{Text: snippet(content)}}
+		results = append(results, r)
+	}
+
+	return results, rows.Err()
+}
+
+// vectorLiteral formats a vector the way pgvector parses it, e.g. [1,0.5]
+func vectorLiteral(v []float32) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, x := range v {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(x), 'g', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+func snippet(content string) string {
+	runes := []rune(strings.Join(strings.Fields(content), " "))
+	if len(runes) <= snippetLength {
+		return string(runes)
+	}
+	return string(runes[:snippetLength]) + "…"
+}
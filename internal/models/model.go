@@ -0,0 +1,200 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Capabilities a model can advertise in the catalog
+const (
+	CapabilityVision    = "vision"
+	CapabilityTools     = "tools"
+	CapabilityReasoning = "reasoning"
+)
+
+type Model struct {
+	ID            int       `json:"id" db:"id"`
+	Provider      string    `json:"provider" db:"provider"`
+	Name          string    `json:"name" db:"name"`
+	DisplayName   string    `json:"display_name" db:"display_name"`
+	ContextWindow int       `json:"context_window" db:"context_window"`
+	Capabilities  []string  `json:"capabilities" db:"capabilities"`
+	InputPrice    float64   `json:"input_price" db:"input_price"`   // USD per million tokens
+	OutputPrice   float64   `json:"output_price" db:"output_price"` // USD per million tokens
+	Enabled       bool      `json:"enabled" db:"enabled"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Ref is the "provider/name" form the provider registry resolves
+func (m *Model) Ref() string {
+	return m.Provider + "/" + m.Name
+}
+
+func (m *Model) HasCapability(capability string) bool {
+	return slices.Contains(m.Capabilities, capability)
+}
+
+type ModelService struct {
+	db *sql.DB
+}
+
+func NewModelService(db *sql.DB) *ModelService {
+	return &ModelService{db: db}
+}
+
+const modelColumns = `
+        id, provider, name, display_name, COALESCE(context_window, 0),
+        capabilities, COALESCE(input_price, 0), COALESCE(output_price, 0),
+        enabled, created_at, updated_at
+    `
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanModel(row rowScanner) (*Model, error) {
+	m := &Model{}
+	var capabilities pq.StringArray
+	err := row.Scan(&m.ID, &m.Provider, &m.Name, &m.DisplayName, &m.ContextWindow,
+		&capabilities, &m.InputPrice, &m.OutputPrice,
+		&m.Enabled, &m.CreatedAt, &m.UpdatedAt)
+	m.Capabilities = capabilities
+	return m, err
+}
+
+func (s *ModelService) GetEnabledModels() ([]Model, error) {
+	query := `SELECT ` + modelColumns + `
+        FROM models
+        WHERE enabled = TRUE
+        ORDER BY provider, display_name
+    `
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var models []Model
+	for rows.Next() {
+		m, err := scanModel(rows)
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, *m)
+	}
+
+	return models, rows.Err()
+}
+
+func (s *ModelService) GetModel(id int) (*Model, error) {
+	query := `SELECT ` + modelColumns + ` FROM models WHERE id = $1`
+	return scanModel(s.db.QueryRow(query, id))
+}
+
+func (s *ModelService) GetModelByRef(provider, name string) (*Model, error) {
+	query := `SELECT ` + modelColumns + ` FROM models WHERE provider = $1 AND name = $2`
+	return scanModel(s.db.QueryRow(query, provider, name))
+}
+
+// EnsureModel returns the catalog entry for a model, adding it when it was
+// discovered at runtime (e.g. pulled into Ollama) but is not in the catalog.
+func (s *ModelService) EnsureModel(provider, name, displayName string) (*Model, error) {
+	m, err := s.GetModelByRef(provider, name)
+	if err == nil {
+		return m, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	query := `
+        INSERT INTO models (provider, name, display_name)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (provider, name) DO NOTHING
+    `
+	if _, err := s.db.Exec(query, provider, name, displayName); err != nil {
+		return nil, err
+	}
+	return s.GetModelByRef(provider, name)
+}
+
+// UpsertModel inserts a model or updates the catalog entry with the same
+// provider and name.
+func (s *ModelService) UpsertModel(m *Model) error {
+	query := `
+        INSERT INTO models (provider, name, display_name, context_window,
+            capabilities, input_price, output_price, enabled)
+        VALUES ($1, $2, $3, NULLIF($4, 0), $5, NULLIF($6, 0), NULLIF($7, 0), $8)
+        ON CONFLICT (provider, name) DO UPDATE SET
+            display_name = EXCLUDED.display_name,
+            context_window = EXCLUDED.context_window,
+            capabilities = EXCLUDED.capabilities,
+            input_price = EXCLUDED.input_price,
+            output_price = EXCLUDED.output_price,
+            enabled = EXCLUDED.enabled,
+            updated_at = NOW()
+        RETURNING id, created_at, updated_at
+    `
+
+	return s.db.QueryRow(query, m.Provider, m.Name, m.DisplayName, m.ContextWindow,
+		pq.StringArray(m.Capabilities), m.InputPrice, m.OutputPrice, m.Enabled).
+		Scan(&m.ID, &m.CreatedAt, &m.UpdatedAt)
+}
+
+// SeedFromFile upserts every model listed in a JSON catalog file. Models
+// missing from the file are left untouched.
+func (s *ModelService) SeedFromFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	catalog, err := parseCatalog(data)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range catalog {
+		if err := s.UpsertModel(&catalog[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(catalog), nil
+}
+
+// catalogEntry is a model as listed in the catalog file, where a missing
+// "enabled" means enabled
+type catalogEntry struct {
+	Model
+	Enabled *bool `json:"enabled"`
+}
+
+func parseCatalog(data []byte) ([]Model, error) {
+	var entries []catalogEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	catalog := make([]Model, len(entries))
+	for i, entry := range entries {
+		m := entry.Model
+		if m.Provider == "" || m.Name == "" {
+			return nil, fmt.Errorf("catalog entry %d: provider and name are required", i+1)
+		}
+		m.Enabled = entry.Enabled == nil || *entry.Enabled
+		if m.Capabilities == nil {
+			m.Capabilities = []string{}
+		}
+		catalog[i] = m
+	}
+	return catalog, nil
+}
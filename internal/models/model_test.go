@@ -0,0 +1,65 @@
+package models
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseCatalog(t *testing.T) {
+	catalog, err := parseCatalog([]byte(`[
+		{"provider": "openai", "name": "gpt-4o", "display_name": "GPT-4o",
+		 "context_window": 128000, "capabilities": ["vision", "tools"],
+		 "input_price": 2.5, "output_price": 10, "enabled": true},
+		{"provider": "openai", "name": "gpt-3.5-turbo", "display_name": "GPT-3.5", "enabled": false},
+		{"provider": "ollama", "name": "llama3", "display_name": "Llama 3"}
+	]`))
+	if err != nil {
+		t.Fatalf("parseCatalog: %v", err)
+	}
+	if len(catalog) != 3 {
+		t.Fatalf("got %d models, want 3", len(catalog))
+	}
+
+	gpt4o := catalog[0]
+	if gpt4o.Ref() != "openai/gpt-4o" || gpt4o.ContextWindow != 128000 || gpt4o.InputPrice != 2.5 ||
+		gpt4o.OutputPrice != 10 || !gpt4o.HasCapability(CapabilityVision) || !gpt4o.Enabled {
+		t.Errorf("gpt-4o = %+v", gpt4o)
+	}
+	if catalog[1].Enabled {
+		t.Error(`"enabled": false came out enabled`)
+	}
+	if !catalog[2].Enabled {
+		t.Error("entry without \"enabled\" came out disabled")
+	}
+	if catalog[2].Capabilities == nil {
+		t.Error("missing capabilities should be empty, not nil")
+	}
+}
+
+func TestParseCatalogRejectsInvalidEntries(t *testing.T) {
+	for _, data := range []string{
+		`{"provider": "openai"}`,
+		`[{"provider": "openai", "display_name": "No name"}]`,
+		`[{"name": "gpt-4o"}]`,
+		`[{"provider": "openai", "name": "gpt-4o", "enabled": "yes"}]`,
+	} {
+		if _, err := parseCatalog([]byte(data)); err == nil {
+			t.Errorf("parseCatalog(%s) succeeded", data)
+		}
+	}
+}
+
+// The catalog shipped with the app must stay loadable
+func TestParseShippedCatalog(t *testing.T) {
+	data, err := os.ReadFile("../../config/models.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := parseCatalog(data)
+	if err != nil {
+		t.Fatalf("parseCatalog: %v", err)
+	}
+	if len(catalog) == 0 {
+		t.Fatal("catalog is empty")
+	}
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+const searchLimit = 50
+
+// Markers ts_headline wraps matches in. Control characters do not show up in
+// chat text, so snippets can be split on them and escaped by the templates
+// instead of trusting HTML built by the database.
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+var headlineOptions = `StartSel="` + highlightStart + `", StopSel="` + highlightStop + `", ` +
+	`MaxFragments=2, MaxWords=20, MinWords=5, FragmentDelimiter=" … "`
+
+// Highlight is a piece of a search snippet, Match marks the query terms
+type Highlight struct {
+	Text  string
+	Match bool
+}
+
+// SearchResult is a message, or a conversation title when MessageID is nil,
+// matching a search query.
+type SearchResult struct {
+	TreeID    int
+	TreeTitle string
+	MessageID *int
+	Role      string
+	Snippet   []Highlight
+	Rank      float64
+	CreatedAt time.Time
+}
+
+// Search finds messages and conversation titles across all of a user's
+// trees, best matches first. The query uses web search syntax: quoted
+// phrases, OR and -excluded words.
+func (s *ChatService) Search(userID int, query string) ([]SearchResult, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, nil
+	}
+
+	sqlQuery := `
+        WITH q AS (SELECT websearch_to_tsquery('english', $2) AS query)
+        SELECT t.id, t.title, m.id, m.role,
+            ts_headline('english', m.content, q.query, $3),
+            ts_rank(m.search_vector, q.query) AS rank, m.created_at
+        FROM messages m
+        JOIN message_trees t ON t.id = m.message_tree_id, q
+        WHERE t.user_id = $1
+          AND m.role IN ('user', 'assistant')
+          AND m.search_vector @@ q.query
+        UNION ALL
+        SELECT t.id, t.title, NULL, '',
+            ts_headline('english', t.title, q.query, $3),
+            ts_rank(t.search_vector, q.query), t.updated_at
+        FROM message_trees t, q
+        WHERE t.user_id = $1
+          AND t.search_vector @@ q.query
+        ORDER BY rank DESC, created_at DESC
+        LIMIT $4
+    `
+
+	rows, err := s.db.Query(sqlQuery, userID, query, headlineOptions, searchLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		var headline string
+		err := rows.Scan(&r.TreeID, &r.TreeTitle, &r.MessageID, &r.Role,
+			&headline, &r.Rank, &r.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		r.Snippet = splitHeadline(headline)
+		results = append(results, r)
+	}
+
+	return results, rows.Err()
+}
+
+// splitHeadline turns ts_headline output into plain and matching pieces
+func splitHeadline(headline string) []Highlight {
+	var parts []Highlight
+	for headline != "" {
+		start := strings.Index(headline, highlightStart)
+		if start < 0 {
+			break
+		}
+		if start > 0 {
+			parts = append(parts, Highlight{Text: headline[:start]})
+		}
+		headline = headline[start+len(highlightStart):]
+
+		stop := strings.Index(headline, highlightStop)
+		if stop < 0 {
+			stop = len(headline)
+		}
+		parts = append(parts, Highlight{Text: headline[:stop], Match: true})
+		headline = strings.TrimPrefix(headline[stop:], highlightStop)
+	}
+	if headline != "" {
+		parts = append(parts, Highlight{Text: headline})
+	}
+	return parts
+}
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Share is a public read-only link to a tree. A snapshot share shows the
+// branch as it was when the link was made, a live share the current one.
+type Share struct {
+	ID            int            `json:"id" db:"id"`
+	MessageTreeID int            `json:"message_tree_id" db:"message_tree_id"`
+	Token         string         `json:"token" db:"token"`
+	Snapshot      *ShareSnapshot `json:"-" db:"snapshot"` // nil for live shares
+	ExpiresAt     *time.Time     `json:"expires_at" db:"expires_at"`
+	CreatedAt     time.Time      `json:"created_at" db:"created_at"`
+
+	// Owner of the tree, only set by GetShare
+	OwnerID   int    `json:"-" db:"-"`
+	OwnerName string `json:"-" db:"-"`
+}
+
+func (s Share) Live() bool {
+	return s.Snapshot == nil
+}
+
+// ShareSnapshot is the frozen copy of a shared branch, stored as JSONB
+type ShareSnapshot struct {
+	Title    string    `json:"title"`
+	Messages []Message `json:"messages"`
+}
+
+func (s *ShareSnapshot) Value() (driver.Value, error) {
+	if s == nil {
+		return nil, nil
+	}
+	return json.Marshal(s)
+}
+
+func (s *ShareSnapshot) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	}
+	return errors.New("unsupported type for share snapshot")
+}
+
+type ShareService struct {
+	db *sql.DB
+}
+
+func NewShareService(db *sql.DB) *ShareService {
+	return &ShareService{db: db}
+}
+
+// newShareToken returns 256 random bits, so links cannot be guessed
+func newShareToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CreateShare mints a link for the tree. Pass a snapshot to freeze what is
+// shown, or nil to share the live tree.
+func (s *ShareService) CreateShare(treeID int, snapshot *ShareSnapshot, expiresAt *time.Time) (*Share, error) {
+	token, err := newShareToken()
+	if err != nil {
+		return nil, err
+	}
+
+	share := &Share{
+		MessageTreeID: treeID,
+		Token:         token,
+		Snapshot:      snapshot,
+		ExpiresAt:     expiresAt,
+	}
+	query := `
+        INSERT INTO tree_shares (message_tree_id, token, snapshot, expires_at)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, created_at
+    `
+	err = s.db.QueryRow(query, treeID, token, snapshot, expiresAt).Scan(&share.ID, &share.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return share, nil
+}
+
+// GetTreeShares lists the links of a tree that have not expired. Snapshots
+// are not loaded.
+func (s *ShareService) GetTreeShares(treeID int) ([]Share, error) {
+	query := `
+        SELECT id, message_tree_id, token, snapshot IS NULL, expires_at, created_at
+        FROM tree_shares
+        WHERE message_tree_id = $1 AND (expires_at IS NULL OR expires_at > NOW())
+        ORDER BY created_at
+    `
+
+	rows, err := s.db.Query(query, treeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []Share
+	for rows.Next() {
+		var share Share
+		var live bool
+		err := rows.Scan(&share.ID, &share.MessageTreeID, &share.Token, &live,
+			&share.ExpiresAt, &share.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if !live {
+			share.Snapshot = &ShareSnapshot{}
+		}
+		shares = append(shares, share)
+	}
+
+	return shares, rows.Err()
+}
+
+// GetShare finds a link by its token, with the owner's display name.
+// Expired links are reported as sql.ErrNoRows like missing ones.
+func (s *ShareService) GetShare(token string) (*Share, error) {
+	query := `
+        SELECT s.id, s.message_tree_id, s.token, s.snapshot, s.expires_at, s.created_at,
+            u.id, u.username
+        FROM tree_shares s
+        JOIN message_trees t ON t.id = s.message_tree_id
+        JOIN users u ON u.id = t.user_id
+        WHERE s.token = $1 AND (s.expires_at IS NULL OR s.expires_at > NOW())
+    `
+
+	share := &Share{}
+	var snapshot []byte
+	err := s.db.QueryRow(query, token).Scan(&share.ID, &share.MessageTreeID, &share.Token,
+		&snapshot, &share.ExpiresAt, &share.CreatedAt, &share.OwnerID, &share.OwnerName)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot != nil {
+		share.Snapshot = &ShareSnapshot{}
+		if err := share.Snapshot.Scan(snapshot); err != nil {
+			return nil, err
+		}
+	}
+	return share, nil
+}
+
+// RevokeShare deletes a link, after which its token no longer resolves
+func (s *ShareService) RevokeShare(shareID, treeID int) error {
+	result, err := s.db.Exec("DELETE FROM tree_shares WHERE id = $1 AND message_tree_id = $2", shareID, treeID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+)
+
+// APIToken authenticates scripts against the JSON API. The secret itself is
+// only known when the token is created.
+type APIToken struct {
+	ID         int        `json:"id" db:"id"`
+	UserID     int        `json:"-" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	LastUsedAt *time.Time `json:"last_used_at" db:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+type TokenService struct {
+	db *sql.DB
+}
+
+func NewTokenService(db *sql.DB) *TokenService {
+	return &TokenService{db: db}
+}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateToken mints a token for the user and returns it with its secret
+func (s *TokenService) CreateToken(userID int, name string) (*APIToken, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	secret := "t3s_" + base64.RawURLEncoding.EncodeToString(b)
+
+	token := &APIToken{UserID: userID, Name: name}
+	query := `
+        INSERT INTO api_tokens (user_id, name, token_hash)
+        VALUES ($1, $2, $3)
+        RETURNING id, created_at
+    `
+	err := s.db.QueryRow(query, userID, name, hashToken(secret)).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return nil, "", err
+	}
+	return token, secret, nil
+}
+
+// Authenticate looks a secret up and records that the token was used
+func (s *TokenService) Authenticate(secret string) (*APIToken, error) {
+	query := `
+        UPDATE api_tokens SET last_used_at = NOW()
+        WHERE token_hash = $1
+        RETURNING id, user_id, name, last_used_at, created_at
+    `
+
+	token := &APIToken{}
+	err := s.db.QueryRow(query, hashToken(secret)).
+		Scan(&token.ID, &token.UserID, &token.Name, &token.LastUsedAt, &token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (s *TokenService) DeleteToken(tokenID, userID int) error {
+	result, err := s.db.Exec("DELETE FROM api_tokens WHERE id = $1 AND user_id = $2", tokenID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
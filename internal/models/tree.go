@@ -0,0 +1,385 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+// execOwned runs an update or delete restricted to trees the user owns and
+// reports sql.ErrNoRows when nothing matched.
+func (s *ChatService) execOwned(query string, args ...any) error {
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *ChatService) RenameTree(treeID, userID int, title string) error {
+	return s.execOwned(`
+        UPDATE message_trees SET title = $1, updated_at = NOW()
+        WHERE id = $2 AND user_id = $3
+    `, title, treeID, userID)
+}
+
+// DeleteTree deletes a tree with its messages and share links. It returns
+// the keys of the attached images that nothing else refers to any more, so
+// the caller can remove them from the blob store. Duplicates, forks and
+// snapshots of other trees may share images with the deleted tree.
+func (s *ChatService) DeleteTree(treeID, userID int) ([]string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var keys pq.StringArray
+	err = tx.QueryRow(`
+        SELECT COALESCE(array_agg(DISTINCT r.key), '{}')
+        FROM messages m
+        CROSS JOIN LATERAL jsonb_array_elements(COALESCE(m.parts, '[]')) AS p(part)
+        CROSS JOIN LATERAL (VALUES (p.part->>'image_ref'), (p.part->>'thumbnail_ref')) AS r(key)
+        WHERE m.message_tree_id = $1 AND r.key IS NOT NULL
+    `, treeID).Scan(&keys)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec("DELETE FROM message_trees WHERE id = $1 AND user_id = $2", treeID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	var orphaned pq.StringArray
+	err = tx.QueryRow(`
+        SELECT COALESCE(array_agg(k), '{}')
+        FROM unnest($1::text[]) AS k
+        WHERE NOT EXISTS (
+            SELECT 1 FROM messages
+            WHERE parts @> jsonb_build_array(jsonb_build_object('image_ref', k))
+               OR parts @> jsonb_build_array(jsonb_build_object('thumbnail_ref', k))
+        )
+        AND NOT EXISTS (
+            SELECT 1 FROM tree_shares
+            WHERE jsonb_path_exists(snapshot,
+                '$.messages[*].parts[*] ? (@.image_ref == $k || @.thumbnail_ref == $k)',
+                jsonb_build_object('k', k))
+        )
+    `, keys).Scan(&orphaned)
+	if err != nil {
+		return nil, err
+	}
+
+	return orphaned, tx.Commit()
+}
+
+// SetPinned does not touch updated_at so pinning does not reorder the list
+func (s *ChatService) SetPinned(treeID, userID int, pinned bool) error {
+	return s.execOwned(`
+        UPDATE message_trees SET pinned = $1
+        WHERE id = $2 AND user_id = $3
+    `, pinned, treeID, userID)
+}
+
+func (s *ChatService) SetArchived(treeID, userID int, archived bool) error {
+	return s.execOwned(`
+        UPDATE message_trees SET archived = $1
+        WHERE id = $2 AND user_id = $3
+    `, archived, treeID, userID)
+}
+
+// DuplicateTree copies a tree with all of its branches. The copy is a new,
+// unpinned and unarchived tree with the same active branch.
+func (s *ChatService) DuplicateTree(treeID, userID int) (*MessageTree, error) {
+	source, err := s.GetMessageTree(treeID, userID)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := s.GetMessagesByTreeID(treeID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	tree, err := createMessageTree(tx, userID, source.AIID)
+	if err != nil {
+		return nil, err
+	}
+	tree.Title = copyTitle(source.Title)
+
+	ids, err := insertMessages(tx, tree.ID, messages)
+	if err != nil {
+		return nil, err
+	}
+	if source.ActiveLeafID != nil {
+		if id, ok := ids[*source.ActiveLeafID]; ok {
+			tree.ActiveLeafID = &id
+		}
+	}
+
+	_, err = tx.Exec("UPDATE message_trees SET title = $1, active_leaf_id = $2 WHERE id = $3",
+		tree.Title, tree.ActiveLeafID, tree.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return tree, tx.Commit()
+}
+
+// titleColumnLength is the size of message_trees.title in characters
+const titleColumnLength = 255
+
+const copySuffix = " (copy)"
+
+// copyTitle marks a title as a copy, shortening it so the suffix still fits
+// the column
+func copyTitle(title string) string {
+	limit := titleColumnLength - utf8.RuneCountInString(copySuffix)
+	if runes := []rune(title); len(runes) > limit {
+		title = string(runes[:limit])
+	}
+	return title + copySuffix
+}
+
+// ForkTree copies a shared branch into a new tree owned by userID, linked
+// to the tree it came from. messages are in path order, from the first
+// message down to the leaf, which becomes the active one.
+func (s *ChatService) ForkTree(userID, sourceTreeID int, title string, messages []Message) (*MessageTree, error) {
+	// Answer with whichever model the conversation ended on
+	var aiID *int
+	for _, msg := range messages {
+		if msg.ModelID != nil {
+			aiID = msg.ModelID
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	tree, err := createMessageTree(tx, userID, aiID)
+	if err != nil {
+		return nil, err
+	}
+	tree.Title = title
+	tree.ForkedFromID = &sourceTreeID
+
+	ids, err := insertMessages(tx, tree.ID, messages)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) > 0 {
+		id := ids[messages[len(messages)-1].ID]
+		tree.ActiveLeafID = &id
+	}
+
+	_, err = tx.Exec(`
+        UPDATE message_trees SET title = $1, active_leaf_id = $2, forked_from_id = $3
+        WHERE id = $4
+    `, tree.Title, tree.ActiveLeafID, tree.ForkedFromID, tree.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return tree, tx.Commit()
+}
+
+var (
+	errOrphanMessage = errors.New("message parent is not part of the copied messages")
+	errMessageCycle  = errors.New("messages are their own ancestors")
+)
+
+// insertMessages bulk inserts messages into a tree in one statement,
+// keeping their branch structure, content, metadata and timestamps. New IDs
+// are drawn from the sequence up front so parents can be remapped in SQL,
+// whatever order messages are in. It returns a map from the given message
+// IDs to the new ones.
+func insertMessages(q querier, treeID int, messages []Message) (map[int]int, error) {
+	if len(messages) == 0 {
+		return map[int]int{}, nil
+	}
+	if err := checkParents(messages); err != nil {
+		return nil, err
+	}
+
+	rows := make([]messageRow, len(messages))
+	for i, msg := range messages {
+		g := msg.Generation
+		rows[i] = messageRow{
+			ID:                 msg.ID,
+			ParentID:           msg.ParentMessageID,
+			Role:               msg.Role,
+			Content:            msg.Parts.Text(),
+			Parts:              msg.Parts,
+			ModelID:            msg.ModelID,
+			PromptTokens:       g.PromptTokens,
+			CompletionTokens:   g.CompletionTokens,
+			TimeToFirstTokenMs: g.TimeToFirstTokenMs,
+			DurationMs:         g.DurationMs,
+			FinishReason:       g.FinishReason,
+			ProviderRequestID:  g.ProviderRequestID,
+			CreatedAt:          msg.CreatedAt,
+		}
+		if rows[i].CreatedAt.IsZero() {
+			rows[i].CreatedAt = time.Now()
+		}
+	}
+	data, err := json.Marshal(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// Foreign keys are checked at the end of the statement, so children may
+	// come before their parents
+	query := `
+        WITH src AS (
+            SELECT * FROM jsonb_to_recordset($2::jsonb) AS s(
+                id INTEGER, parent_id INTEGER, role TEXT, content TEXT, parts JSONB,
+                model_id INTEGER, prompt_tokens INTEGER, completion_tokens INTEGER,
+                time_to_first_token_ms INTEGER, duration_ms INTEGER,
+                finish_reason TEXT, provider_request_id TEXT, created_at TIMESTAMPTZ)
+        ), ids AS (
+            SELECT id AS old_id, nextval(pg_get_serial_sequence('messages', 'id'))::INTEGER AS new_id
+            FROM src
+        ), inserted AS (
+            INSERT INTO messages (id, message_tree_id, parent_message_id, role, content, parts, model_id,
+                prompt_tokens, completion_tokens, time_to_first_token_ms, duration_ms,
+                finish_reason, provider_request_id, created_at)
+            SELECT i.new_id, $1::INTEGER, p.new_id, s.role, s.content, COALESCE(s.parts, '[]'), s.model_id,
+                NULLIF(s.prompt_tokens, 0), NULLIF(s.completion_tokens, 0),
+                NULLIF(s.time_to_first_token_ms, 0), NULLIF(s.duration_ms, 0),
+                NULLIF(s.finish_reason, ''), NULLIF(s.provider_request_id, ''), s.created_at
+            FROM src s
+            JOIN ids i ON i.old_id = s.id
+            LEFT JOIN ids p ON p.old_id = s.parent_id
+        )
+        SELECT old_id, new_id FROM ids
+    `
+
+	result, err := q.Query(query, treeID, string(data))
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	ids := make(map[int]int, len(messages))
+	for result.Next() {
+		var oldID, newID int
+		if err := result.Scan(&oldID, &newID); err != nil {
+			return nil, err
+		}
+		ids[oldID] = newID
+	}
+	return ids, result.Err()
+}
+
+// messageRow is a message as insertMessages hands it to jsonb_to_recordset
+type messageRow struct {
+	ID                 int       `json:"id"`
+	ParentID           *int      `json:"parent_id"`
+	Role               string    `json:"role"`
+	Content            string    `json:"content"`
+	Parts              Parts     `json:"parts"`
+	ModelID            *int      `json:"model_id"`
+	PromptTokens       int       `json:"prompt_tokens"`
+	CompletionTokens   int       `json:"completion_tokens"`
+	TimeToFirstTokenMs int       `json:"time_to_first_token_ms"`
+	DurationMs         int       `json:"duration_ms"`
+	FinishReason       string    `json:"finish_reason"`
+	ProviderRequestID  string    `json:"provider_request_id"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+// checkParents makes sure every parent is among the messages and that
+// following parents always ends at a root
+func checkParents(messages []Message) error {
+	parents := make(map[int]*int, len(messages))
+	for _, msg := range messages {
+		parents[msg.ID] = msg.ParentMessageID
+	}
+
+	rooted := map[int]bool{}
+	for _, msg := range messages {
+		var path []int
+		for id := msg.ID; !rooted[id]; {
+			if len(path) > len(messages) {
+				return errMessageCycle
+			}
+			path = append(path, id)
+			parent, ok := parents[id]
+			if !ok {
+				return errOrphanMessage
+			}
+			if parent == nil {
+				break
+			}
+			id = *parent
+		}
+		for _, id := range path {
+			rooted[id] = true
+		}
+	}
+	return nil
+}
+
+// ImportTree stores a conversation from elsewhere as a new tree, keeping
+// its title, timestamps and branches. Message and active leaf IDs refer to
+// the source and are mapped to the new ones.
+func (s *ChatService) ImportTree(userID int, source MessageTree, messages []Message) (*MessageTree, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	tree, err := createMessageTree(tx, userID, source.AIID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := insertMessages(tx, tree.ID, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	tree.Title = source.Title
+	if source.ActiveLeafID != nil {
+		if id, ok := ids[*source.ActiveLeafID]; ok {
+			tree.ActiveLeafID = &id
+		}
+	}
+	if !source.CreatedAt.IsZero() {
+		tree.CreatedAt = source.CreatedAt
+	}
+	if !source.UpdatedAt.IsZero() {
+		tree.UpdatedAt = source.UpdatedAt
+	}
+
+	_, err = tx.Exec(`
+        UPDATE message_trees SET title = $1, active_leaf_id = $2, created_at = $3, updated_at = $4
+        WHERE id = $5
+    `, tree.Title, tree.ActiveLeafID, tree.CreatedAt, tree.UpdatedAt, tree.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return tree, tx.Commit()
+}
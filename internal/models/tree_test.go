@@ -0,0 +1,57 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCopyTitle(t *testing.T) {
+	if got := copyTitle("Trip plans"); got != "Trip plans (copy)" {
+		t.Errorf("copyTitle = %q", got)
+	}
+
+	// Multi-byte titles are cut by characters, not bytes
+	long := strings.Repeat("é", titleColumnLength)
+	got := copyTitle(long)
+	if n := utf8.RuneCountInString(got); n != titleColumnLength {
+		t.Errorf("copy of a %d character title has %d characters, want %d", titleColumnLength, n, titleColumnLength)
+	}
+	if !utf8.ValidString(got) || !strings.HasSuffix(got, " (copy)") {
+		t.Errorf("copyTitle = %q", got)
+	}
+
+	// Copying a copy again still fits
+	if n := utf8.RuneCountInString(copyTitle(got)); n > titleColumnLength {
+		t.Errorf("copy of a copy has %d characters", n)
+	}
+}
+
+func TestCheckParents(t *testing.T) {
+	id := func(n int) *int { return &n }
+	tests := []struct {
+		name     string
+		messages []Message
+		want     error
+	}{
+		{"children before parents", []Message{
+			{ID: 3, ParentMessageID: id(2)},
+			{ID: 2, ParentMessageID: id(1)},
+			{ID: 4, ParentMessageID: id(1)},
+			{ID: 1},
+		}, nil},
+		{"several roots", []Message{{ID: 1}, {ID: 2}, {ID: 3, ParentMessageID: id(2)}}, nil},
+		{"missing parent", []Message{{ID: 1}, {ID: 2, ParentMessageID: id(9)}}, errOrphanMessage},
+		{"cycle", []Message{
+			{ID: 1},
+			{ID: 2, ParentMessageID: id(3)},
+			{ID: 3, ParentMessageID: id(2)},
+		}, errMessageCycle},
+		{"own parent", []Message{{ID: 1, ParentMessageID: id(1)}}, errMessageCycle},
+	}
+	for _, tt := range tests {
+		if err := checkParents(tt.messages); err != tt.want {
+			t.Errorf("%s: checkParents = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
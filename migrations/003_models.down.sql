@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_message_trees_ai_id;
+ALTER TABLE message_trees DROP CONSTRAINT IF EXISTS fk_message_trees_ai_id;
+DROP TABLE IF EXISTS models;
\ No newline at end of file
@@ -0,0 +1,24 @@
+-- Create models table
+CREATE TABLE models (
+    id SERIAL PRIMARY KEY,
+    provider VARCHAR(50) NOT NULL,
+    name VARCHAR(255) NOT NULL, -- Model name as the provider knows it
+    display_name VARCHAR(255) NOT NULL,
+    context_window INTEGER,
+    capabilities TEXT[] NOT NULL DEFAULT '{}', -- e.g. vision, tools, reasoning
+    input_price NUMERIC(12, 6), -- USD per million prompt tokens
+    output_price NUMERIC(12, 6), -- USD per million completion tokens
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (provider, name)
+);
+
+-- message_trees.ai_id finally has something to reference
+ALTER TABLE message_trees
+    ADD CONSTRAINT fk_message_trees_ai_id
+    FOREIGN KEY (ai_id) REFERENCES models(id) ON DELETE SET NULL;
+
+-- Create indexes
+CREATE INDEX idx_models_enabled ON models(enabled);
+CREATE INDEX idx_message_trees_ai_id ON message_trees(ai_id);
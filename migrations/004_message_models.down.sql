@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_messages_model_id;
+ALTER TABLE messages DROP COLUMN IF EXISTS model_id;
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- Record which model produced each assistant message
+ALTER TABLE messages ADD COLUMN model_id INTEGER REFERENCES models(id) ON DELETE SET NULL;
+
+-- Create indexes
+CREATE INDEX idx_messages_model_id ON messages(model_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_messages_parent_message_id;
+ALTER TABLE message_trees DROP COLUMN IF EXISTS active_leaf_id;
+ALTER TABLE messages DROP COLUMN IF EXISTS parent_message_id;
\ No newline at end of file
@@ -0,0 +1,25 @@
+-- Messages form a tree: every message points at the one it answers
+ALTER TABLE messages ADD COLUMN parent_message_id INTEGER REFERENCES messages(id) ON DELETE CASCADE;
+
+-- The leaf of the branch currently shown for a tree
+ALTER TABLE message_trees ADD COLUMN active_leaf_id INTEGER REFERENCES messages(id) ON DELETE SET NULL;
+
+-- Existing conversations were flat, so chain them in creation order
+UPDATE messages m
+SET parent_message_id = ordered.prev_id
+FROM (
+    SELECT id, LAG(id) OVER (PARTITION BY message_tree_id ORDER BY created_at, id) AS prev_id
+    FROM messages
+) ordered
+WHERE m.id = ordered.id;
+
+UPDATE message_trees t
+SET active_leaf_id = (
+    SELECT id FROM messages
+    WHERE message_tree_id = t.id
+    ORDER BY created_at DESC, id DESC
+    LIMIT 1
+);
+
+-- Create indexes
+CREATE INDEX idx_messages_parent_message_id ON messages(parent_message_id);
@@ -0,0 +1,4 @@
+ALTER TABLE messages ADD COLUMN is_incoming BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE messages SET is_incoming = (role <> 'user');
+ALTER TABLE messages DROP COLUMN IF EXISTS parts;
+ALTER TABLE messages DROP COLUMN IF EXISTS role;
\ No newline at end of file
@@ -0,0 +1,14 @@
+-- Replace the is_incoming flag with a role and structured content parts
+ALTER TABLE messages ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user'
+    CHECK (role IN ('system', 'user', 'assistant', 'tool'));
+ALTER TABLE messages ADD COLUMN parts JSONB NOT NULL DEFAULT '[]';
+
+-- Existing rows only ever held plain text
+UPDATE messages
+SET role = CASE WHEN is_incoming THEN 'assistant' ELSE 'user' END,
+    parts = jsonb_build_array(jsonb_build_object('type', 'text', 'text', content));
+
+ALTER TABLE messages DROP COLUMN is_incoming;
+
+-- content keeps the plain text of all text parts
+COMMENT ON COLUMN messages.content IS 'Plain text of the text parts';
@@ -0,0 +1,6 @@
+ALTER TABLE messages DROP COLUMN IF EXISTS provider_request_id;
+ALTER TABLE messages DROP COLUMN IF EXISTS finish_reason;
+ALTER TABLE messages DROP COLUMN IF EXISTS duration_ms;
+ALTER TABLE messages DROP COLUMN IF EXISTS time_to_first_token_ms;
+ALTER TABLE messages DROP COLUMN IF EXISTS completion_tokens;
+ALTER TABLE messages DROP COLUMN IF EXISTS prompt_tokens;
\ No newline at end of file
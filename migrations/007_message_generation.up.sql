@@ -0,0 +1,7 @@
+-- Generation metadata for assistant messages, NULL for everything else
+ALTER TABLE messages ADD COLUMN prompt_tokens INTEGER;
+ALTER TABLE messages ADD COLUMN completion_tokens INTEGER;
+ALTER TABLE messages ADD COLUMN time_to_first_token_ms INTEGER;
+ALTER TABLE messages ADD COLUMN duration_ms INTEGER;
+ALTER TABLE messages ADD COLUMN finish_reason VARCHAR(50);
+ALTER TABLE messages ADD COLUMN provider_request_id VARCHAR(255);
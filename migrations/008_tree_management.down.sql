@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_message_trees_user_archived;
+ALTER TABLE message_trees DROP COLUMN IF EXISTS archived;
+ALTER TABLE message_trees DROP COLUMN IF EXISTS pinned;
\ No newline at end of file
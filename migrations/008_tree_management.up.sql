@@ -0,0 +1,6 @@
+-- Pinned trees are listed first, archived ones are hidden by default
+ALTER TABLE message_trees ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE message_trees ADD COLUMN archived BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Create indexes
+CREATE INDEX idx_message_trees_user_archived ON message_trees(user_id, archived);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_message_trees_search_vector;
+DROP INDEX IF EXISTS idx_messages_search_vector;
+ALTER TABLE message_trees DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE messages DROP COLUMN IF EXISTS search_vector;
\ No newline at end of file
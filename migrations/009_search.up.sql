@@ -0,0 +1,9 @@
+-- Full-text search over message content and conversation titles
+ALTER TABLE messages ADD COLUMN search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('english', COALESCE(content, ''))) STORED;
+ALTER TABLE message_trees ADD COLUMN search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('english', COALESCE(title, ''))) STORED;
+
+-- Create indexes
+CREATE INDEX idx_messages_search_vector ON messages USING GIN (search_vector);
+CREATE INDEX idx_message_trees_search_vector ON message_trees USING GIN (search_vector);
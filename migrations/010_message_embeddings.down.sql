@@ -0,0 +1 @@
+DROP TABLE IF EXISTS message_embeddings;
\ No newline at end of file
@@ -0,0 +1,13 @@
+-- One embedding per message and embedder. The vector has no fixed dimension
+-- so embedders can be swapped, which rules out an ANN index; searches scan a
+-- single user's messages, which stays fast enough.
+CREATE TABLE message_embeddings (
+    message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    embedder VARCHAR(100) NOT NULL,
+    embedding vector NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (message_id, embedder)
+);
+
+-- Create indexes
+CREATE INDEX idx_message_embeddings_embedder ON message_embeddings(embedder);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS document_chunks;
+DROP TABLE IF EXISTS documents;
\ No newline at end of file
@@ -0,0 +1,23 @@
+-- Files attached to a conversation for retrieval-augmented generation
+CREATE TABLE documents (
+    id SERIAL PRIMARY KEY,
+    message_tree_id INTEGER NOT NULL REFERENCES message_trees(id) ON DELETE CASCADE,
+    filename VARCHAR(255) NOT NULL,
+    mime_type VARCHAR(100) NOT NULL,
+    size_bytes INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Chunks are embedded on upload with the embedder named alongside
+CREATE TABLE document_chunks (
+    id SERIAL PRIMARY KEY,
+    document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    chunk_index INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    embedder VARCHAR(100) NOT NULL,
+    embedding vector NOT NULL,
+    UNIQUE (document_id, chunk_index)
+);
+
+-- Create indexes
+CREATE INDEX idx_documents_tree_id ON documents(message_tree_id);
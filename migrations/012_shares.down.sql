@@ -0,0 +1 @@
+DROP TABLE IF EXISTS tree_shares;
\ No newline at end of file
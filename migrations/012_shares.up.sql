@@ -0,0 +1,13 @@
+-- Public read-only links to a conversation. Snapshot shares keep a copy of
+-- the branch taken at share time, live shares read the tree on each view.
+CREATE TABLE tree_shares (
+    id SERIAL PRIMARY KEY,
+    message_tree_id INTEGER NOT NULL REFERENCES message_trees(id) ON DELETE CASCADE,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    snapshot JSONB,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Create indexes
+CREATE INDEX idx_tree_shares_tree_id ON tree_shares(message_tree_id);
@@ -0,0 +1 @@
+ALTER TABLE message_trees DROP COLUMN IF EXISTS forked_from_id;
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- Trees continued from a share link remember where they came from
+ALTER TABLE message_trees
+    ADD COLUMN forked_from_id INTEGER REFERENCES message_trees(id) ON DELETE SET NULL;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS message_embedding_failures;
\ No newline at end of file
@@ -0,0 +1,10 @@
+-- Messages an embedder failed on. The indexer skips them for a while and
+-- gives up after a few attempts, so one bad message cannot stall indexing.
+CREATE TABLE message_embedding_failures (
+    message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    embedder VARCHAR(100) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    last_error TEXT NOT NULL,
+    failed_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (message_id, embedder)
+);